@@ -0,0 +1,4045 @@
+package animoji
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/colornames"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Version is the animoji version recorded in GIF comments and manifests, and
+// sent when fetching input images.
+var Version = "dev"
+
+// Options holds the settings used to render and encode an animation,
+// including parameters that tune the behavior of individual effects. Fields
+// with no meaningful zero value, such as Colors or PixelateGrid, take the
+// default of the matching command line flag when left zero. Fields whose
+// zero is a setting of its own, such as Center, PinchStrength or
+// KaleidoscopeReflect, are used as given, so start from DefaultOptions to
+// render effects as the command line does.
+type Options struct {
+	Frames      int     // Number of frames in the animation
+	Delay       float64 // Average delay between frames, in 100ths of a second
+	Reverse     bool    // Reverse the order of frames
+	Supersample int     // Render at this multiple of the output resolution, at its square times the cost
+	Oversample  int     // Render this many subframes per frame and average them, for motion blur (0 or 1 = off)
+	Jobs        int     // Maximum number of frames rendered concurrently
+	Optimize    bool    // Encode only the changed region of each frame, drawn over the previous one (Disposal is then ignored)
+	Disposal    byte    // GIF disposal method for every frame (0 = unspecified)
+	Comment     string  // Text of the GIF comment extension, if any
+	Seed        int64   // Master seed from which effects derive their randomness
+	Colors      int     // Maximum number of colors in the palette (2 to 256)
+
+	Palette color.Palette // Fixed palette to quantize frames to instead of one built from the image (nil = build one)
+
+	Dither string // Dithering when converting frames to the palette: "ordered", "floyd" or "none"
+
+	AlphaThreshold int // Pixels with alpha below this (1 to 255, or 0 for 128) become transparent in the GIF; the rest become opaque
+
+	Center [2]float64  // Center of radial effects, as x, y fractions of the image
+	Mask   *image.Gray // Where effects apply: white fully, black not at all (nil = everywhere)
+	Image2 image.Image // Second input image that morph dissolves into (nil if none)
+
+	Crossfade int // Frames over which adjacent staged effects blend into each other
+
+	Sync bool // Drive every looping effect from the animation's clock rather than its own stage's
+
+	Bursts      map[string]int // Effects applied only in bursts, by name, each starting every this many frames
+	BurstLength int            // Number of frames each burst lasts
+
+	// Ramps holds the start and end values of effect parameters given as a
+	// start:end range, keyed by flag name (see rampedParams). The parameter
+	// fields hold the start value until resolved for a frame with at.
+	Ramps map[string][2]float64
+
+	// OnFrame, if set, is called with each frame as soon as it has been
+	// rendered, before any palette conversion. index is the frame's position
+	// in the output. Frames are rendered in parallel, so calls may come from
+	// several goroutines at once and in any order. The frame is only valid
+	// for the duration of the call and must not be modified.
+	OnFrame func(index int, frame image.Image)
+
+	// OnStage, if set, is called with the image after each effect in the
+	// chain has been applied to a frame, for debugging pipelines. frameIdx
+	// is the frame's position before any reversing, stage counts the
+	// effects from 0 and name is the effect's name. The image is at the
+	// rendering resolution, before the mask is applied. Like OnFrame, calls
+	// may come from several goroutines at once, and the image is only valid
+	// for the duration of the call.
+	OnStage func(frameIdx, stage int, name string, img image.Image)
+
+	RippleMode  string  // "radial" or "linear"
+	RippleAngle float64 // Direction of travel for linear ripples, in degrees
+	RippleEdge  string  // Sampling beyond the image edges: "clamp" (also if empty), "wrap", "reflect" or "transparent"
+
+	PixelateGrid    int    // Number of blocks across the final pixelated frame
+	PixelateReverse bool   // Start pixelated and end at the original image
+	PixelateShape   string // Mosaic tile shape: "square", "circle" or "hex"
+
+	LoopSmooth bool   // Progressive effects return to their start state for a seamless loop
+	Easing     string // Easing curve for the 360 rotation: linear, ease-in, ease-out or ease-in-out
+
+	Spins int // Full turns the 360 rotation makes over the animation
+
+	HueCycles int // Full cycles hue makes through the hue range over the animation
+
+	PinchStrength float64 // How strongly pinch pulls pixels toward the center at its peak
+
+	TwirlTurns float64 // Full turns twirl has twisted the center by the last frame
+
+	SpotlightColor  color.RGBA // Tint color of the spotlight
+	SpotlightRadius float64    // Spotlight radius as a fraction of the smaller image dimension
+
+	GlowIntensity float64 // Brightness of the glow halo (0 = no glow)
+	GlowRadius    int     // Blur radius of the glow halo, in pixels
+
+	HeatAmplitude float64 // Maximum vertical displacement of the heat haze, in pixels
+
+	KaleidoscopeZoom    float64 // Magnification of the mirrored kaleidoscope pattern
+	KaleidoscopeReflect bool    // Mirror alternate kaleidoscope segments rather than only rotating them
+
+	JitterAmount int // Maximum offset of each color channel in rgbjitter, in pixels
+
+	CMYKOffset int // Maximum misregistration of the cyan, magenta and yellow plates in cmyk, in pixels
+
+	ASCIICell int    // Width and height of each ascii character cell, in pixels
+	ASCIIRamp []rune // Glyphs ascii draws, from the darkest cells to the brightest
+
+	asciiGlyphs [][]uint8 // Coverage of the ASCIIRamp glyphs, built once per render (nil = build per frame)
+
+	pixelScale float64 // Rendered pixels per output pixel, set by scalePixels when supersampling (0 = 1)
+
+	JellyStiffness float64 // Number of wobbles jelly makes over the loop
+	JellyDamping   float64 // How quickly the jelly wobble dies down, coming to rest by the end of the loop (0 = never)
+
+	KenBurnsFrom [2]float64 // Point (x, y fractions of the image) kenburns starts centered on
+	KenBurnsTo   [2]float64 // Point (x, y fractions of the image) kenburns ends centered on
+	KenBurnsZoom [2]float64 // Zoom factor of kenburns on the first and last frames
+
+	ReflectRipple float64 // Maximum sideways displacement of the water reflection, in pixels
+
+	GradientStops []color.RGBA // Colors gradientmap maps luminance onto, from dark to light
+	GradientCycle bool         // Shift the gradient back and forth across the frames
+
+	BounceHeight float64 // Height bounce drops from, as a fraction of the image height
+
+	TileCount int // Number of copies of the image across and down in tile
+
+	HueRange [2]float64 // Band of source hues recolor shifts, as low, high in degrees (low > high wraps through 0)
+
+	ChannelOrder [][3]bool // Sets of red, green and blue channels channel shows in turn (every non-empty set if empty)
+
+	OutlineWidth int        // Thickness of the outline stroke, in pixels
+	OutlineColor color.RGBA // Color of the outline stroke
+	OutlineCycle bool       // Cycle the outline stroke through the full hue range instead of using OutlineColor
+
+	VibesSmooth  bool // Rotate the vibes tints smoothly around the hue wheel instead of switching between four colors
+	VibesFeather int  // Width in pixels of the band over which neighboring vibes quarters blend (0 = hard edges)
+
+	GrowFrom float64 // Scale grow starts from, as a fraction of full size
+
+	ZoomBlurStrength float64 // Extra zoom of the farthest copy zoomblur averages on the last frame (0 = no blur)
+
+	Quality string // Sampling between pixels: "fast" (nearest neighbor) or "good" (bilinear, also if empty)
+}
+
+// sampler returns the function effects use to sample the source image at
+// fractional positions, as chosen by Quality.
+func (o Options) sampler() sampleFunc {
+	if o.Quality == "fast" {
+		return sampleNearest
+	}
+	return sampleBilinear
+}
+
+// rampedParams returns pointers to the parameter fields that accept a
+// start:end range, keyed by flag name.
+func (o *Options) rampedParams() map[string]*float64 {
+	return map[string]*float64{
+		"ripple-angle":      &o.RippleAngle,
+		"pinch-strength":    &o.PinchStrength,
+		"twirl-turns":       &o.TwirlTurns,
+		"spotlight-radius":  &o.SpotlightRadius,
+		"glow-intensity":    &o.GlowIntensity,
+		"heat-amplitude":    &o.HeatAmplitude,
+		"kaleidoscope-zoom": &o.KaleidoscopeZoom,
+		"reflect-ripple":    &o.ReflectRipple,
+		"bounce-height":     &o.BounceHeight,
+	}
+}
+
+// at returns a copy of the options with each ramped parameter set to its
+// value at progress t (0 to 1) through its range, eased by the Easing curve.
+func (o Options) at(t float64) Options {
+	if len(o.Ramps) == 0 {
+		return o
+	}
+	params := o.rampedParams()
+	eased := applyEasing(o.Easing, t)
+	for name, ramp := range o.Ramps {
+		*params[name] = ramp[0] + (ramp[1]-ramp[0])*eased
+	}
+	return o
+}
+
+// defaultGradient is the gradientmap gradient used when none is given.
+var defaultGradient = []color.RGBA{{0x1b, 0x0c, 0x3f, 0xff}, {0xc2, 0x18, 0x5b, 0xff}, {0xff, 0xd5, 0x4f, 0xff}}
+
+// DefaultOptions returns the options the command line renders with when no
+// flags are given: 12 frames at 6 frames per second, with every effect
+// parameter at the default of its flag.
+func DefaultOptions() Options {
+	return Options{
+		Frames:         12,
+		Delay:          100.0 / 6,
+		Supersample:    1,
+		Oversample:     1,
+		Jobs:           runtime.NumCPU(),
+		Colors:         256,
+		Quality:        "good",
+		Dither:         "none",
+		AlphaThreshold: 128,
+
+		RippleMode:    "radial",
+		RippleEdge:    "clamp",
+		PixelateGrid:  4,
+		PixelateShape: "square",
+		Easing:        "linear",
+		Spins:         1,
+		HueCycles:     1,
+		Center:        [2]float64{0.5, 0.5},
+
+		SpotlightColor:  color.RGBA{0xff, 0xff, 0x00, 0xff},
+		SpotlightRadius: 0.25,
+
+		PinchStrength:       1,
+		TwirlTurns:          1,
+		GlowIntensity:       1,
+		GlowRadius:          4,
+		HeatAmplitude:       3,
+		KaleidoscopeZoom:    1,
+		KaleidoscopeReflect: true,
+		JitterAmount:        3,
+		CMYKOffset:          2,
+
+		KenBurnsFrom: [2]float64{0.3, 0.3},
+		KenBurnsTo:   [2]float64{0.7, 0.7},
+		KenBurnsZoom: [2]float64{1.2, 1.6},
+
+		ReflectRipple: 2,
+		GradientStops: slices.Clone(defaultGradient),
+		BounceHeight:  0.5,
+		TileCount:     3,
+		HueRange:      [2]float64{330, 30},
+		OutlineWidth:  3,
+		OutlineColor:  color.RGBA{0xff, 0xff, 0xff, 0xff},
+
+		ZoomBlurStrength: 0.3,
+		BurstLength:      2,
+
+		ASCIICell: 8,
+		ASCIIRamp: []rune(DefaultASCIIRamp),
+
+		JellyStiffness: 3,
+		JellyDamping:   3,
+	}
+}
+
+// withDefaults returns a copy of the options with each field that has no
+// meaningful zero value, such as Colors or PixelateGrid, set to the default
+// of the matching command line flag if it was left zero, so that a partly
+// filled in Options still renders. Fields whose zero is a setting of its
+// own are left alone; DefaultOptions sets those too.
+func (o Options) withDefaults() Options {
+	setDefault := func(p *int, value int) {
+		if *p == 0 {
+			*p = value
+		}
+	}
+	setDefault(&o.Supersample, 1)
+	setDefault(&o.Oversample, 1)
+	setDefault(&o.Jobs, runtime.NumCPU())
+	setDefault(&o.Colors, 256)
+	setDefault(&o.PixelateGrid, 4)
+	setDefault(&o.Spins, 1)
+	setDefault(&o.HueCycles, 1)
+	setDefault(&o.GlowRadius, 4)
+	setDefault(&o.TileCount, 3)
+	setDefault(&o.OutlineWidth, 3)
+	setDefault(&o.ASCIICell, 8)
+	setDefault(&o.AlphaThreshold, 128)
+	if len(o.Bursts) > 0 {
+		setDefault(&o.BurstLength, 2)
+	}
+
+	setDefaultString := func(p *string, value string) {
+		if *p == "" {
+			*p = value
+		}
+	}
+	setDefaultString(&o.Dither, "none")
+	setDefaultString(&o.RippleMode, "radial")
+	setDefaultString(&o.RippleEdge, "clamp")
+	setDefaultString(&o.PixelateShape, "square")
+	setDefaultString(&o.Easing, "linear")
+	setDefaultString(&o.Quality, "good")
+
+	if o.SpotlightRadius == 0 {
+		o.SpotlightRadius = 0.25
+	}
+	if o.KaleidoscopeZoom == 0 {
+		o.KaleidoscopeZoom = 1
+	}
+	if o.JellyStiffness == 0 {
+		o.JellyStiffness = 3
+	}
+	if o.KenBurnsZoom == [2]float64{} {
+		o.KenBurnsZoom = [2]float64{1.2, 1.6}
+	}
+	if o.GradientStops == nil {
+		o.GradientStops = defaultGradient
+	}
+	if o.ASCIIRamp == nil {
+		o.ASCIIRamp = []rune(DefaultASCIIRamp)
+	}
+	return o
+}
+
+// Validate reports the first option that is out of range, such as a
+// negative strength or an unknown dithering method. Parameters given as a
+// start:end range in Ramps must be valid at both ends.
+func (o Options) Validate() error {
+	switch {
+	case o.Frames <= 0:
+		return fmt.Errorf("number of frames must be positive")
+	case o.Delay < 0 || o.Delay > 0 && o.Delay < 1:
+		return fmt.Errorf("frame delay must be at least 1 (100ths of a second), for a rate of at most 100 frames per second")
+	case o.Crossfade < 0:
+		return fmt.Errorf("crossfade must be non-negative")
+	case len(o.Bursts) > 0 && o.BurstLength < 1:
+		return fmt.Errorf("burst length must be at least 1")
+	case o.Jobs < 1:
+		return fmt.Errorf("number of jobs must be at least 1")
+	case o.Colors < 2 || o.Colors > 256:
+		return fmt.Errorf("number of colors must be between 2 and 256")
+	case o.AlphaThreshold < 0 || o.AlphaThreshold > 255:
+		return fmt.Errorf("alpha threshold must be between 0 and 255 (got %d)", o.AlphaThreshold)
+	case o.Dither != "ordered" && o.Dither != "floyd" && o.Dither != "none":
+		return fmt.Errorf("unknown dither: %s (expected ordered, floyd or none)", o.Dither)
+	case o.Supersample < 1:
+		return fmt.Errorf("supersample factor must be at least 1")
+	case o.Oversample < 1:
+		return fmt.Errorf("oversample factor must be at least 1")
+	case o.Quality != "fast" && o.Quality != "good":
+		return fmt.Errorf("unknown quality: %s (expected fast or good)", o.Quality)
+	case o.RippleMode != "radial" && o.RippleMode != "linear":
+		return fmt.Errorf("unknown ripple mode: %s (expected radial or linear)", o.RippleMode)
+	case o.RippleEdge != "clamp" && o.RippleEdge != "wrap" && o.RippleEdge != "reflect" && o.RippleEdge != "transparent":
+		return fmt.Errorf("unknown ripple edge: %s (expected clamp, wrap, reflect or transparent)", o.RippleEdge)
+	case !validEasing(o.Easing):
+		return fmt.Errorf("unknown easing: %s (expected linear, ease-in, ease-out or ease-in-out)", o.Easing)
+	case o.Spins < 1:
+		return fmt.Errorf("spins must be at least 1 (got %d)", o.Spins)
+	case o.HueCycles < 1:
+		return fmt.Errorf("hue cycles must be at least 1 (got %d)", o.HueCycles)
+	case o.PixelateGrid < 1:
+		return fmt.Errorf("pixelate grid size must be at least 1")
+	case o.PixelateShape != "square" && o.PixelateShape != "circle" && o.PixelateShape != "hex":
+		return fmt.Errorf("unknown pixelate shape: %s (expected square, circle or hex)", o.PixelateShape)
+	case o.GlowRadius < 1:
+		return fmt.Errorf("glow radius must be at least 1")
+	case o.JitterAmount < 0:
+		return fmt.Errorf("jitter amount must be non-negative")
+	case o.CMYKOffset < 0:
+		return fmt.Errorf("CMYK offset must be non-negative")
+	case o.ASCIICell < 2:
+		return fmt.Errorf("ASCII cell size must be at least 2")
+	case o.JellyStiffness <= 0:
+		return fmt.Errorf("jelly stiffness must be positive")
+	case o.JellyDamping < 0:
+		return fmt.Errorf("jelly damping must be non-negative")
+	case o.Center[0] < 0 || o.Center[0] > 1 || o.Center[1] < 0 || o.Center[1] > 1:
+		return fmt.Errorf("center must be fractions between 0 and 1")
+	case o.KenBurnsZoom[0] < 1 || o.KenBurnsZoom[1] < 1:
+		return fmt.Errorf("kenburns zoom must be at least 1")
+	case len(o.GradientStops) < 2:
+		return fmt.Errorf("a gradient needs at least two colors")
+	case o.HueRange[0] < 0 || o.HueRange[0] > 360 || o.HueRange[1] < 0 || o.HueRange[1] > 360:
+		return fmt.Errorf("hue range must be between 0 and 360 degrees")
+	case o.OutlineWidth < 1:
+		return fmt.Errorf("outline width must be at least 1")
+	case o.VibesFeather < 0:
+		return fmt.Errorf("vibes feather must be non-negative")
+	case o.GrowFrom < 0 || o.GrowFrom > 1:
+		return fmt.Errorf("grow from must be between 0 and 1")
+	case o.ZoomBlurStrength < 0:
+		return fmt.Errorf("zoom blur strength must be non-negative")
+	case o.TileCount < 1:
+		return fmt.Errorf("tile count must be at least 1")
+	}
+	for _, v := range append(o.KenBurnsFrom[:], o.KenBurnsTo[:]...) {
+		if v < 0 || v > 1 {
+			return fmt.Errorf("kenburns points must be fractions between 0 and 1")
+		}
+	}
+	if err := checkASCIIRamp(o.ASCIIRamp); err != nil {
+		return fmt.Errorf("invalid ASCII ramp: %w", err)
+	}
+	for name, every := range o.Bursts {
+		if _, ok := LookupEffect(name); !ok {
+			return fmt.Errorf("unknown effect in bursts: %s", name)
+		}
+		if every < 1 {
+			return fmt.Errorf("burst interval of %s must be at least 1 (got %d)", name, every)
+		}
+	}
+	for _, channels := range o.ChannelOrder {
+		if channels == [3]bool{} {
+			return fmt.Errorf("empty channel set in channel order")
+		}
+	}
+
+	params := o.rampedParams()
+	for name := range o.Ramps {
+		if _, ok := params[name]; !ok {
+			return fmt.Errorf("%s can't be given as a start:end range", name)
+		}
+	}
+	for _, p := range []Options{o, o.at(1)} {
+		switch {
+		case p.PinchStrength < 0:
+			return fmt.Errorf("pinch strength must be non-negative")
+		case p.SpotlightRadius <= 0:
+			return fmt.Errorf("spotlight radius must be positive")
+		case p.GlowIntensity < 0:
+			return fmt.Errorf("glow intensity must be non-negative")
+		case p.HeatAmplitude < 0:
+			return fmt.Errorf("heat amplitude must be non-negative")
+		case p.KaleidoscopeZoom <= 0:
+			return fmt.Errorf("kaleidoscope zoom must be positive")
+		case p.ReflectRipple < 0:
+			return fmt.Errorf("reflect ripple must be non-negative")
+		case p.BounceHeight < 0 || p.BounceHeight > 1:
+			return fmt.Errorf("bounce height must be between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// EffectSpec is an effect parsed from a subcommand argument, such as
+// "ripple", "ripple+0.25", "ripple~0.3" or "ripple@0:6".
+type EffectSpec struct {
+	Name   string  // Effect name
+	Phase  float64 // Fraction of a cycle looping effects are shifted ahead by (0 to 1)
+	Mix    float64 // How much of the effect's output is blended over its input (0 to 1)
+	Staged bool    // Whether the effect only applies to a range of frames
+	Start  int     // First frame a staged effect applies to
+	End    int     // Frame after the last one a staged effect applies to (0 = through the last frame)
+}
+
+// ParseEffectSpec parses a subcommand of the form
+// name[+phase][~mix][@start:end], where phase shifts a looping effect ahead
+// by that fraction of its cycle, mix is the fraction of the effect to apply
+// (default 1, the full effect) and start:end limits the effect to frames
+// start to end-1. Either end of the range may be left out to extend it to
+// the first or last frame.
+func ParseEffectSpec(arg string) (EffectSpec, error) {
+	arg, rangeStr, hasRange := strings.Cut(arg, "@")
+	arg, mixStr, hasMix := strings.Cut(arg, "~")
+	name, phaseStr, hasPhase := strings.Cut(arg, "+")
+	effect := EffectSpec{Name: name, Mix: 1.0}
+
+	if hasPhase {
+		phase, err := strconv.ParseFloat(phaseStr, 64)
+		if err != nil || phase < 0 || phase > 1 {
+			return EffectSpec{}, fmt.Errorf("phase offset must be a number from 0 to 1 (got '%s')", phaseStr)
+		}
+		effect.Phase = phase
+	}
+
+	if hasRange {
+		startStr, endStr, ok := strings.Cut(rangeStr, ":")
+		if !ok {
+			return EffectSpec{}, fmt.Errorf("frame range must be start:end (got '%s')", rangeStr)
+		}
+		effect.Staged = true
+		var err error
+		if startStr != "" {
+			effect.Start, err = strconv.Atoi(startStr)
+			if err != nil || effect.Start < 0 {
+				return EffectSpec{}, fmt.Errorf("frame range start must be a non-negative integer (got '%s')", startStr)
+			}
+		}
+		if endStr != "" {
+			effect.End, err = strconv.Atoi(endStr)
+			if err != nil || effect.End <= effect.Start {
+				return EffectSpec{}, fmt.Errorf("frame range end must be an integer after the start (got '%s')", endStr)
+			}
+		}
+	}
+
+	if hasMix {
+		mix, err := strconv.ParseFloat(mixStr, 64)
+		if err != nil || mix < 0 || mix > 1 {
+			return EffectSpec{}, fmt.Errorf("mix must be a number from 0 to 1 (got '%s')", mixStr)
+		}
+		effect.Mix = mix
+	}
+
+	return effect, nil
+}
+
+// Stage returns the range of frames, from start to end-1, that the effect
+// applies to in an animation of frameCount frames.
+func (e EffectSpec) Stage(frameCount int) (start, end int) {
+	if !e.Staged {
+		return 0, frameCount
+	}
+	end = e.End
+	if end == 0 {
+		end = frameCount
+	}
+	return e.Start, end
+}
+
+// phase returns how far through its cycle a looping effect is, from 0 up to
+// 1, on frame stageIdx of the stageCount frames it runs for. With sync, every
+// effect follows the same clock across the whole animation instead, so that
+// staged effects pick up where the loop is rather than starting over. Either
+// way the effect's phase offset is added.
+func (e EffectSpec) phase(stageIdx, stageCount, frameIdx, frameCount int, sync bool) float64 {
+	phase := float64(stageIdx) / float64(stageCount)
+	if sync {
+		phase = float64(frameIdx) / float64(frameCount)
+	}
+	phase += e.Phase
+	return phase - math.Floor(phase)
+}
+
+// weight returns how strongly the effect applies to the given frame, from 0
+// (not at all) to 1. Staged effects apply fully within their range. With a
+// crossfade, they fade in over crossfade frames centered on the start of the
+// range and fade out over crossfade frames centered on the end, so that
+// adjacent stages overlap with weights that sum to 1.
+func (e EffectSpec) weight(frameIdx, frameCount, crossfade int) float64 {
+	start, end := e.Stage(frameCount)
+	if crossfade == 0 {
+		if frameIdx >= start && frameIdx < end {
+			return 1.0
+		}
+		return 0.0
+	}
+
+	// Measure from frame centers so the ramps are symmetric
+	half := float64(crossfade) / 2.0
+	t := float64(frameIdx) + 0.5
+	weight := 1.0
+	if start > 0 {
+		weight = math.Min(weight, (t-(float64(start)-half))/float64(crossfade))
+	}
+	if end < frameCount {
+		weight = math.Min(weight, ((float64(end)+half)-t)/float64(crossfade))
+	}
+	return math.Max(0.0, math.Min(1.0, weight))
+}
+
+// blendImages sets dst to a blend of the from and to images, where mix 0 is
+// entirely from and 1 is entirely to. dst may be the same image as to.
+func blendImages(dst *image.RGBA, from, to image.Image, mix float64) {
+	bounds := dst.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			fromR, fromG, fromB, fromA := from.At(x, y).RGBA()
+			toR, toG, toB, toA := to.At(x, y).RGBA()
+
+			// Formula: result = from * (1 - mix) + to * mix
+			blend := func(a, b uint32) uint8 {
+				return clamp8((float64(a>>8)*(1.0-mix) + float64(b>>8)*mix) + 0.5)
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{blend(fromR, toR), blend(fromG, toG), blend(fromB, toB), blend(fromA, toA)})
+		}
+	}
+}
+
+// blendMasked blends from and to into dst, using the mask's gray level at
+// each pixel as the fraction of to: white gives to, black gives from.
+func blendMasked(dst *image.RGBA, from, to image.Image, mask *image.Gray) {
+	bounds := dst.Bounds()
+	offset := mask.Bounds().Min.Sub(bounds.Min)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			fromR, fromG, fromB, fromA := from.At(x, y).RGBA()
+			toR, toG, toB, toA := to.At(x, y).RGBA()
+			mix := float64(mask.GrayAt(x+offset.X, y+offset.Y).Y) / 255.0
+
+			// Formula: result = from * (1 - mix) + to * mix
+			blend := func(a, b uint32) uint8 {
+				return clamp8((float64(a>>8)*(1.0-mix) + float64(b>>8)*mix) + 0.5)
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{blend(fromR, toR), blend(fromG, toG), blend(fromB, toB), blend(fromA, toA)})
+		}
+	}
+}
+
+// clamp8 converts a blended channel value to uint8, saturating at 0 and 255
+// instead of wrapping around, which would turn overbright pixels black.
+// Fractions are truncated, so add 0.5 first to round.
+func clamp8(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, v)))
+}
+
+// GenerateFrames renders every frame of the animation by applying the named
+// effects (subcommands such as "ripple" or "ripple~0.3", or Aliases for
+// chains of them) in sequence to img. The frames are returned as full-color
+// RGBA images, without the palette conversion or encoding needed for a GIF,
+// so they can be encoded to other formats or analyzed directly.
+func GenerateFrames(img image.Image, effects []string, opts Options) ([]image.Image, error) {
+	specs, opts, err := parseEffects(img, effects, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]image.Image, 0, opts.Frames)
+	err = renderFrames(ToRGBA(img), specs, opts,
+		func(frame *image.RGBA, _ image.Rectangle) *image.RGBA {
+			// Copy the frame out of the worker's reusable buffers
+			return ToRGBA(frame)
+		},
+		func(frame *image.RGBA) error {
+			frames = append(frames, frame)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return frames, nil
+}
+
+// WriteGIF renders the animation of the named effects applied to img, like
+// GenerateFrames, and encodes it as an animated GIF to w, one frame at a time.
+// Frames are shown for opts.Delay 100ths of a second on average. The palette
+// is built from img (and opts.Image2) with up to opts.Colors colors, or 256
+// if Colors is zero. The writer is not closed.
+func WriteGIF(w io.Writer, img image.Image, effects []string, opts Options) error {
+	specs, opts, err := parseEffects(img, effects, opts)
+	if err != nil {
+		return err
+	}
+
+	img = ToRGBA(img)
+	palette := BuildPalette(img, specs, opts)
+
+	// Clear each frame to the background when the palette contains
+	// transparent colors to avoid ghosting, as the command line does
+	if opts.Disposal == 0 && HasTransparency(palette) {
+		opts.Disposal = gif.DisposalBackground
+	}
+
+	return EncodeGIF(w, img, specs, palette, opts)
+}
+
+// ApplyBytes renders the animation like WriteGIF and returns the encoded GIF,
+// for callers such as web handlers that need the bytes rather than a writer.
+// The whole GIF is buffered in memory.
+func ApplyBytes(img image.Image, effects []string, opts Options) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteGIF(&buf, img, effects, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseEffects checks the options passed to the library functions against
+// img and parses the named effects. It returns the options with defaults
+// filled in for the fields left zero (see withDefaults).
+func parseEffects(img image.Image, effects []string, opts Options) ([]EffectSpec, Options, error) {
+	opts = opts.withDefaults()
+	if err := opts.Validate(); err != nil {
+		return nil, opts, err
+	}
+	if img.Bounds().Empty() {
+		return nil, opts, fmt.Errorf("image is empty (%dx%d)", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	if opts.Mask != nil && opts.Mask.Bounds().Size() != img.Bounds().Size() {
+		return nil, opts, fmt.Errorf("mask size %v does not match image size %v", opts.Mask.Bounds().Size(), img.Bounds().Size())
+	}
+	if opts.Image2 != nil && opts.Image2.Bounds().Size() != img.Bounds().Size() {
+		return nil, opts, fmt.Errorf("second image size %v does not match image size %v", opts.Image2.Bounds().Size(), img.Bounds().Size())
+	}
+
+	effects, err := ExpandAliases(effects)
+	if err != nil {
+		return nil, opts, err
+	}
+	specs := make([]EffectSpec, len(effects))
+	for i, effect := range effects {
+		spec, err := ParseEffectSpec(effect)
+		if err != nil {
+			return nil, opts, fmt.Errorf("invalid effect %s: %w", effect, err)
+		}
+		if _, ok := LookupEffect(spec.Name); !ok {
+			return nil, opts, fmt.Errorf("unknown effect: %s", spec.Name)
+		}
+		if _, end := spec.Stage(opts.Frames); end > opts.Frames || spec.Staged && spec.Start >= opts.Frames {
+			return nil, opts, fmt.Errorf("frame range of %s is outside the %d frames", effect, opts.Frames)
+		}
+		specs[i] = spec
+	}
+	for name := range opts.Bursts {
+		if !slices.ContainsFunc(specs, func(e EffectSpec) bool { return e.Name == name }) {
+			return nil, opts, fmt.Errorf("burst effect %s is not one of the effects", name)
+		}
+	}
+	if err := CheckEffects(img, specs, opts); err != nil {
+		return nil, opts, err
+	}
+	return specs, opts, nil
+}
+
+// CheckEffects reports the first effect that can't be applied to img with
+// the options, such as 360 on an image that isn't square, so the problem is
+// found before any frames are rendered.
+func CheckEffects(img image.Image, effects []EffectSpec, opts Options) error {
+	size := img.Bounds().Size()
+	for _, effect := range effects {
+		switch effect.Name {
+		case "360":
+			if size.X != size.Y {
+				return fmt.Errorf("the 360 subcommand requires a square image (got %dx%d; use -autopad to pad it to a square, or a square -canvas)", size.X, size.Y)
+			}
+		case "morph":
+			if opts.Image2 == nil {
+				return fmt.Errorf("the morph subcommand requires a second image (-in2)")
+			}
+		}
+	}
+	return nil
+}
+
+// CheckPipeline applies each effect on its own to the first frame of its
+// range, for -check, and returns an error for every effect that can't be
+// applied to img, whether CheckEffects rules it out, it returns an error or
+// it panics. An image with no pixels fails as a whole.
+func CheckPipeline(img image.Image, effects []EffectSpec, opts Options) []error {
+	opts = opts.withDefaults()
+	size := img.Bounds().Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return []error{fmt.Errorf("the image has no pixels (got %dx%d)", size.X, size.Y)}
+	}
+
+	var errs []error
+	dst := image.NewRGBA(img.Bounds())
+	for i, effect := range effects {
+		if err := CheckEffects(img, effects[i:i+1], opts); err != nil {
+			errs = append(errs, fmt.Errorf("effect %d (%s): %w", i+1, effect.Name, err))
+			continue
+		}
+		if err := checkEffect(dst, img, i, effect, opts); err != nil {
+			errs = append(errs, fmt.Errorf("effect %d (%s): %w", i+1, effect.Name, err))
+		}
+	}
+	return errs
+}
+
+// checkEffect applies one effect to the first frame of its range, turning a
+// panic into an error so that CheckPipeline can carry on with the rest.
+func checkEffect(dst *image.RGBA, img image.Image, i int, effect EffectSpec, opts Options) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	start, end := effect.Stage(opts.Frames)
+	rng := effectRand(opts.Seed, i, start)
+	_, err = applyEffectToFrame(dst, img, effect.Name, 0, end-start, effect.phase(0, end-start, start, opts.Frames, opts.Sync), opts.at(0), rng)
+	return err
+}
+
+// renderFrames renders every frame of the animation using up to opts.Jobs
+// concurrent workers. Each rendered frame is passed to convert on its
+// worker's goroutine, and is only valid for the duration of that call, along
+// with the region the effects changed (outside it the frame matches img). The
+// converted frames are then passed to emit in output order. No more than
+// opts.Jobs converted frames are held in memory waiting to be emitted.
+func renderFrames[T any](img image.Image, effects []EffectSpec, opts Options, convert func(frame *image.RGBA, dirty image.Rectangle) T, emit func(frame T) error) error {
+	frameCount := opts.Frames
+	jobs := max(1, min(opts.Jobs, frameCount))
+
+	img, opts = renderInputs(img, effects, opts)
+
+	type result struct {
+		frame T
+		err   error
+	}
+	results := make([]chan result, frameCount)
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+
+	// Hand out frame indices, waiting for a free slot before each one so
+	// that finished frames don't pile up ahead of the one being emitted
+	slots := make(chan struct{}, jobs)
+	indices := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(indices)
+		for i := 0; i < frameCount; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case indices <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < jobs; w++ {
+		go func() {
+			// Each worker reuses its own buffers for every frame it renders
+			buf := &frameBuffers{}
+			for i := range indices {
+				// Render frames backwards if reversing
+				frameIdx := i
+				if opts.Reverse {
+					frameIdx = frameCount - 1 - i
+				}
+				frame, dirty, err := renderOutputFrame(img, effects, frameIdx, opts, buf)
+				if err != nil {
+					results[i] <- result{err: err}
+					continue
+				}
+				if opts.OnFrame != nil {
+					opts.OnFrame(i, frame)
+				}
+				results[i] <- result{frame: convert(frame, dirty)}
+			}
+		}()
+	}
+
+	// Emit frames in order as they complete
+	for i := 0; i < frameCount; i++ {
+		r := <-results[i]
+		if r.err != nil {
+			return r.err
+		}
+		if err := emit(r.frame); err != nil {
+			return err
+		}
+		<-slots
+	}
+
+	return nil
+}
+
+// renderInputs prepares the image and options for rendering the effects:
+// the image, mask and second image are upscaled to the internal rendering
+// resolution when supersampling, along with the parameters measured in
+// pixels, and the ascii glyphs are built once rather than for every frame.
+func renderInputs(img image.Image, effects []EffectSpec, opts Options) (image.Image, Options) {
+	if opts.Supersample > 1 {
+		opts = opts.scalePixels(opts.Supersample)
+		img = upscaleImage(img, opts.Supersample)
+		if opts.Mask != nil {
+			opts.Mask = ToGray(upscaleImage(opts.Mask, opts.Supersample))
+		}
+		if opts.Image2 != nil {
+			opts.Image2 = upscaleImage(opts.Image2, opts.Supersample)
+		}
+	}
+	if slices.ContainsFunc(effects, func(e EffectSpec) bool { return e.Name == "ascii" }) {
+		opts.asciiGlyphs = asciiGlyphs(opts.ASCIIRamp, opts.ASCIICell)
+	}
+	return img, opts
+}
+
+// scalePixels returns a copy of the options with every parameter measured in
+// pixels multiplied by scale, so that effects rendered at scale times the
+// output resolution look the same once scaled back down.
+func (o Options) scalePixels(scale int) Options {
+	s := float64(scale)
+	o.pixelScale = s
+	o.HeatAmplitude *= s
+	o.ReflectRipple *= s
+	o.GlowRadius *= scale
+	o.JitterAmount *= scale
+	o.CMYKOffset *= scale
+	o.ASCIICell *= scale
+	o.OutlineWidth *= scale
+	o.VibesFeather *= scale
+	if len(o.Ramps) > 0 {
+		ramps := maps.Clone(o.Ramps)
+		for _, name := range []string{"heat-amplitude", "reflect-ripple"} {
+			if ramp, ok := ramps[name]; ok {
+				ramps[name] = [2]float64{ramp[0] * s, ramp[1] * s}
+			}
+		}
+		o.Ramps = ramps
+	}
+	return o
+}
+
+// frameBuffers holds images that are reused from frame to frame, so that
+// rendering doesn't allocate a new image for every effect on every frame.
+// Chained effects alternate between the front and back buffers. A
+// frameBuffers must not be shared between goroutines.
+type frameBuffers struct {
+	front, back *image.RGBA
+	crossfade   *image.RGBA
+	downscaled  *image.RGBA
+	oversampled *image.RGBA
+	sum         []uint32 // Running totals of each channel of the subframes
+}
+
+// rgba returns *img resized to the bounds, reusing its pixels if the size
+// already matches. The contents are not cleared.
+func (b *frameBuffers) rgba(img **image.RGBA, bounds image.Rectangle) *image.RGBA {
+	if *img == nil || (*img).Bounds() != bounds {
+		*img = image.NewRGBA(bounds)
+	}
+	return *img
+}
+
+// renderOutputFrame renders a single frame at output resolution, averaging
+// its subframes if oversampling and scaling it back down if the source image
+// has been supersampled.
+func renderOutputFrame(img image.Image, effects []EffectSpec, frameIdx int, opts Options, buf *frameBuffers) (*image.RGBA, image.Rectangle, error) {
+	var currentImg *image.RGBA
+	var dirty image.Rectangle
+	var err error
+	if opts.Oversample > 1 {
+		currentImg, dirty, err = renderOversampled(img, effects, frameIdx, opts, buf)
+	} else {
+		currentImg, dirty, err = renderFrame(img, effects, frameIdx, opts.Frames, opts, buf)
+	}
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+
+	// Downscale back to output resolution, averaging the supersamples
+	if opts.Supersample > 1 {
+		bounds := currentImg.Bounds()
+		size := image.Rect(0, 0, bounds.Dx()/opts.Supersample, bounds.Dy()/opts.Supersample)
+		downscaled := buf.rgba(&buf.downscaled, size)
+		downscaleArea(downscaled, currentImg, opts.Supersample)
+		currentImg = downscaled
+
+		// Widen the changed region to the output pixels it touches
+		n := opts.Supersample
+		dirty = dirty.Sub(bounds.Min)
+		dirty = image.Rect(dirty.Min.X/n, dirty.Min.Y/n, (dirty.Max.X+n-1)/n, (dirty.Max.Y+n-1)/n).Intersect(size)
+	}
+
+	return currentImg, dirty, nil
+}
+
+// renderOversampled renders frame frameIdx as the average of opts.Oversample
+// subframes spread through it, as if the animation had that many times as
+// many frames, so that fast motion is blurred along its path (a temporal box
+// filter). Staged effect ranges and the crossfade are scaled to the subframes.
+func renderOversampled(img image.Image, effects []EffectSpec, frameIdx int, opts Options, buf *frameBuffers) (*image.RGBA, image.Rectangle, error) {
+	n := opts.Oversample
+	scaled := make([]EffectSpec, len(effects))
+	for i, effect := range effects {
+		effect.Start *= n
+		effect.End *= n
+		scaled[i] = effect
+	}
+	opts.Crossfade *= n
+	bursts := make(map[string]int, len(opts.Bursts))
+	for name, every := range opts.Bursts {
+		bursts[name] = every * n
+	}
+	opts.Bursts = bursts
+	opts.BurstLength *= n
+
+	// Report the stages of the first subframe as those of the frame
+	onStage := opts.OnStage
+	opts.OnStage = nil
+
+	bounds := img.Bounds()
+	if len(buf.sum) != bounds.Dx()*bounds.Dy()*4 {
+		buf.sum = make([]uint32, bounds.Dx()*bounds.Dy()*4)
+	} else {
+		clear(buf.sum)
+	}
+
+	var dirty image.Rectangle
+	for k := 0; k < n; k++ {
+		if k == 0 && onStage != nil {
+			opts.OnStage = func(_, stage int, name string, img image.Image) {
+				onStage(frameIdx, stage, name, img)
+			}
+		} else {
+			opts.OnStage = nil
+		}
+		frame, changed, err := renderFrame(img, scaled, frameIdx*n+k, opts.Frames*n, opts, buf)
+		if err != nil {
+			return nil, image.Rectangle{}, err
+		}
+		dirty = dirty.Union(changed)
+
+		i := 0
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			row := frame.Pix[frame.PixOffset(bounds.Min.X, y):][:bounds.Dx()*4]
+			for _, v := range row {
+				buf.sum[i] += uint32(v)
+				i++
+			}
+		}
+	}
+
+	averaged := buf.rgba(&buf.oversampled, bounds)
+	for i, total := range buf.sum {
+		averaged.Pix[i] = uint8((total + uint32(n)/2) / uint32(n))
+	}
+	return averaged, dirty, nil
+}
+
+// toPaletted converts an image to the palette with the named dithering:
+// "floyd" for Floyd-Steinberg error diffusion, "ordered" for a Bayer matrix,
+// or anything else to map each pixel to the nearest palette color. GIFs have
+// no partial transparency, so pixels with alpha below alphaThreshold become
+// transparent and the rest are made opaque first.
+func toPaletted(img *image.RGBA, palette color.Palette, dither string, alphaThreshold int) *image.Paletted {
+	img = thresholdAlpha(img, alphaThreshold)
+	paletted := image.NewPaletted(img.Bounds(), palette)
+	switch dither {
+	case "floyd":
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, img.Bounds().Min)
+	case "ordered":
+		drawOrdered(paletted, img)
+	default:
+		draw.Draw(paletted, paletted.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+	return paletted
+}
+
+// thresholdAlpha returns img with every pixel either fully transparent, if
+// its alpha is below threshold (or zero), or fully opaque in its own color.
+// Fully opaque images are returned unchanged rather than copied.
+func thresholdAlpha(img *image.RGBA, threshold int) *image.RGBA {
+	if img.Opaque() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			if c.A == 0 || int(c.A) < threshold {
+				continue
+			}
+			// Undo the premultiplication by alpha
+			unpremultiply := func(v uint8) uint8 {
+				return uint8(min(255, (int(v)*255+int(c.A)/2)/int(c.A)))
+			}
+			result.SetRGBA(x, y, color.RGBA{unpremultiply(c.R), unpremultiply(c.G), unpremultiply(c.B), 255})
+		}
+	}
+	return result
+}
+
+// copyPaletted copies src into the same region of dst. Both must share a
+// palette.
+func copyPaletted(dst, src *image.Paletted) {
+	bounds := src.Bounds().Intersect(dst.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		copy(dst.Pix[dst.PixOffset(bounds.Min.X, y):dst.PixOffset(bounds.Max.X, y)], src.Pix[src.PixOffset(bounds.Min.X, y):])
+	}
+}
+
+// bayer4 is a 4x4 ordered dither matrix of thresholds from 0 to 15.
+var bayer4 = [4][4]float64{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// drawOrdered converts img to the palette of dst with ordered dithering. Each
+// pixel is nudged by a threshold that depends only on its position before the
+// nearest palette color is chosen, so unlike error diffusion, identical areas
+// of different frames dither identically and static regions don't crawl.
+func drawOrdered(dst *image.Paletted, img image.Image) {
+	// Nudge by about the spacing of the palette colors in each channel, as
+	// if they were spread evenly through the color cube
+	spread := 255.0 / math.Cbrt(float64(len(dst.Palette)))
+
+	bounds := dst.Bounds()
+	offset := img.Bounds().Min.Sub(bounds.Min)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x+offset.X, y+offset.Y)).(color.RGBA)
+			if c.A != 0 {
+				// Keep the premultiplied channels within alpha
+				nudge := spread * ((bayer4[y&3][x&3]+0.5)/16.0 - 0.5)
+				adjust := func(v uint8) uint8 {
+					return uint8(math.Max(0, math.Min(float64(c.A), math.Round(float64(v)+nudge))))
+				}
+				c = color.RGBA{adjust(c.R), adjust(c.G), adjust(c.B), c.A}
+			}
+			dst.SetColorIndex(x, y, uint8(dst.Palette.Index(c)))
+		}
+	}
+}
+
+// renderFrame generates a single frame of the animation by applying each
+// effect in sequence to the source image. It does no palette conversion, so
+// the result can be inspected or compared directly. The returned image is
+// one of buf's buffers and is only valid until buf is next used; pass nil
+// to render into newly allocated images. Along with the frame it returns the
+// region the effects changed, outside which the frame is identical to img.
+// Each effect reads the previous effect's output (see applyEffectToFrame)
+// and img itself is never written to.
+func renderFrame(img image.Image, effects []EffectSpec, frameIdx, frameCount int, opts Options, buf *frameBuffers) (*image.RGBA, image.Rectangle, error) {
+	if buf == nil {
+		buf = &frameBuffers{}
+	}
+	bounds := img.Bounds()
+	dst := buf.rgba(&buf.front, bounds)
+	spare := buf.rgba(&buf.back, bounds)
+
+	// Start with the original image
+	var currentImg image.Image = img
+	if len(effects) == 0 {
+		draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+		return dst, image.Rectangle{}, nil
+	}
+
+	// Track the union of the regions the effects change
+	var dirty image.Rectangle
+
+	// apply renders effect i from the current image into out. Staged
+	// effects run through their whole cycle within their own range of
+	// frames, holding their first or last frame while fading in or out.
+	apply := func(out *image.RGBA, i int) error {
+		effect := effects[i]
+		start, end := effect.Stage(frameCount)
+		stageIdx := max(0, min(end-start-1, frameIdx-start))
+		rng := effectRand(opts.Seed, i, frameIdx)
+		effectOpts := opts.at(effectProgress(stageIdx, end-start, opts.LoopSmooth))
+		changed, err := applyEffectToFrame(out, currentImg, effect.Name, stageIdx, end-start, effect.phase(stageIdx, end-start, frameIdx, frameCount, opts.Sync), effectOpts, rng)
+		if err != nil {
+			return fmt.Errorf("applying effect %s to frame %d: %w", effect.Name, frameIdx, err)
+		}
+		dirty = dirty.Union(changed)
+
+		// Blend the effect's output with its input if partially mixed
+		if effect.Mix < 1 {
+			blendImages(out, currentImg, out, effect.Mix)
+		}
+		return nil
+	}
+
+	// Apply each effect in sequence, writing into whichever buffer doesn't
+	// hold the current image
+	for i := 0; i < len(effects); i++ {
+		// Staged effects outside their range pass the image through
+		weight := effects[i].weight(frameIdx, frameCount, opts.Crossfade)
+		if weight == 0 {
+			continue
+		}
+
+		if err := apply(dst, i); err != nil {
+			return nil, image.Rectangle{}, err
+		}
+
+		if weight < 1 {
+			// Crossfade into the next stage if it starts where this one
+			// ends, applying both to the same input, or else fade this
+			// effect with its input
+			_, end := effects[i].Stage(frameCount)
+			nextWeight := 0.0
+			if i+1 < len(effects) && effects[i+1].Staged && effects[i+1].Start == end {
+				nextWeight = effects[i+1].weight(frameIdx, frameCount, opts.Crossfade)
+			}
+			if nextWeight > 0 {
+				next := buf.rgba(&buf.crossfade, bounds)
+				if err := apply(next, i+1); err != nil {
+					return nil, image.Rectangle{}, err
+				}
+				blendImages(dst, dst, next, nextWeight)
+				i++
+			} else {
+				blendImages(dst, currentImg, dst, weight)
+			}
+		}
+
+		currentImg = dst
+		dst, spare = spare, dst
+
+		if opts.OnStage != nil {
+			opts.OnStage(frameIdx, i, effects[i].Name, currentImg)
+		}
+	}
+
+	// Render into a buffer even if every effect was skipped, since the
+	// frame may be modified after it is returned
+	if currentImg == img {
+		draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+		currentImg = dst
+		dst = spare
+	}
+
+	// Keep the original image where the mask excludes the effects
+	if opts.Mask != nil {
+		blendMasked(dst, img, currentImg, opts.Mask)
+		currentImg = dst
+	}
+
+	return currentImg.(*image.RGBA), dirty, nil
+}
+
+// effectRand returns the random source for one effect in the pipeline on one
+// frame. Each source is derived only from the master seed and the effect and
+// frame indices, so output is reproducible for a given seed no matter which
+// order the frames are rendered in.
+func effectRand(seed int64, effectIdx, frameIdx int) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), uint64(effectIdx)<<32|uint64(uint32(frameIdx))))
+}
+
+// applyEffectToFrame renders one effect for the given frame from img into
+// dst. dst must have the same bounds as img and must not be img itself; any
+// previous contents of dst are cleared. Effects that need randomness must
+// draw it only from rng. It returns the region of dst the effect may have
+// changed; outside it dst is an exact copy of img. Effects that transform
+// the whole frame return the full bounds. Effects that loop take their
+// position in the cycle from phase, from 0 up to 1, rather than from
+// frameIdx, so that the pipeline can shift or synchronize them; frameIdx
+// and frameCount drive progressive effects and those that step every frame.
+//
+// Chained effects rely on the following contract. An effect reads only img
+// and writes only dst, and keeps no reference to either after it returns,
+// since renderFrame passes the previous effect's output as img and reuses
+// both buffers for the next effect and the next frame. Its output depends
+// only on img and its arguments, never on earlier calls, so frames can be
+// rendered in any order and on any goroutine. Effects are applied in the
+// order given and don't commute: ripple followed by pixelate distorts the
+// image and then breaks it into blocks, while pixelate followed by ripple
+// distorts the blocks.
+func applyEffectToFrame(dst *image.RGBA, img image.Image, subcommand string, frameIdx, frameCount int, phase float64, opts Options, rng *rand.Rand) (image.Rectangle, error) {
+	bounds := img.Bounds()
+	sample := opts.sampler()
+	clear(dst.Pix)
+
+	// Between bursts the image passes through unchanged
+	if every := opts.Bursts[subcommand]; every > 0 && frameIdx%every >= opts.BurstLength {
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+		return image.Rectangle{}, nil
+	}
+
+	switch subcommand {
+	case "360":
+		direction := 1.0
+		// Ease the rotation over the loop; progress never reaches 1, so the
+		// last frame leads back into the first after whole turns
+		progress := applyEasing(opts.Easing, phase)
+		angle := progress * 2.0 * math.Pi * float64(opts.Spins) * direction
+		width := bounds.Dx()
+		height := bounds.Dy()
+		if width != height {
+			return image.Rectangle{}, fmt.Errorf("image must be square (got %dx%d)", width, height)
+		}
+		size := width
+		center := float64(size) / 2.0
+		drawRotatedImage(dst, img, center, center, angle, sample)
+		return bounds, nil
+
+	case "none":
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+		return image.Rectangle{}, nil
+
+	case "hue":
+		// Every cycle is complete, so the loop still closes
+		hueShift := phase * 360.0 * float64(opts.HueCycles)
+		applyHueShift(dst, img, hueShift)
+		return bounds, nil
+
+	case "zoom":
+		minZoom := 1.0
+		maxZoom := 6.0
+		progress := effectProgress(frameIdx, frameCount, opts.LoopSmooth)
+		zoom := minZoom + (maxZoom-minZoom)*progress
+		if zoom <= 1.0 {
+			draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+			return image.Rectangle{}, nil
+		}
+		applyZoom(dst, img, zoom, sample)
+		return bounds, nil
+
+	case "pixelate":
+		width := bounds.Dx()
+		height := bounds.Dy()
+		minBlockSize := 1.0
+		grid := float64(opts.PixelateGrid)
+		maxBlockSizeX := float64(width) / grid
+		maxBlockSizeY := float64(height) / grid
+		maxBlockSize := math.Min(maxBlockSizeX, maxBlockSizeY)
+		progress := effectProgress(frameIdx, frameCount, opts.LoopSmooth)
+		if opts.PixelateReverse {
+			progress = 1 - progress
+		}
+		blockSize := minBlockSize + (maxBlockSize-minBlockSize)*progress
+		if blockSize <= 1.0 {
+			draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+			return image.Rectangle{}, nil
+		}
+		applyPixelate(dst, img, blockSize, opts.PixelateShape)
+		return bounds, nil
+
+	case "recolor":
+		hueShift := phase * 360.0
+		applyRecolor(dst, img, hueShift, opts.HueRange[0], opts.HueRange[1])
+		return bounds, nil
+
+	case "tint-rgb":
+		hue := phase * 360.0
+		applyTint(dst, img, hue)
+		return bounds, nil
+
+	case "pinch":
+		centerX, centerY, maxDistance := effectCenter(bounds, opts.Center)
+		strength := opts.PinchStrength * effectProgress(frameIdx, frameCount, opts.LoopSmooth)
+		applyPinch(dst, img, centerX, centerY, maxDistance, strength, sample)
+		return bounds, nil
+
+	case "twirl":
+		maxTwist := opts.TwirlTurns * 2.0 * math.Pi
+		progress := effectProgress(frameIdx, frameCount, opts.LoopSmooth)
+		centerX, centerY, _ := effectCenter(bounds, opts.Center)
+		radius := float64(min(bounds.Dx(), bounds.Dy())) / 2.0
+		applyTwirl(dst, img, centerX, centerY, radius, maxTwist, progress, sample)
+		return bounds, nil
+
+	case "spotlight":
+		width := float64(bounds.Dx())
+		height := float64(bounds.Dy())
+		radius := opts.SpotlightRadius * math.Min(width, height)
+		// Sweep the spotlight around an ellipse so the animation loops
+		radians := phase * 2.0 * math.Pi
+		orbitX := math.Max(0, width/2.0-radius)
+		orbitY := math.Max(0, height/2.0-radius)
+		cx := float64(bounds.Min.X) + width/2.0 + orbitX*math.Cos(radians)
+		cy := float64(bounds.Min.Y) + height/2.0 + orbitY*math.Sin(radians)
+		applySpotlight(dst, img, cx, cy, radius, opts.SpotlightColor, 0.5)
+		// Only the circle is tinted
+		circle := image.Rect(int(math.Floor(cx-radius)), int(math.Floor(cy-radius)), int(math.Ceil(cx+radius)), int(math.Ceil(cy+radius)))
+		return circle.Intersect(bounds), nil
+
+	case "glow":
+		hue := phase * 360.0
+		applyGlow(dst, img, hue, opts.GlowRadius, opts.GlowIntensity)
+		return bounds, nil
+
+	case "heat":
+		radians := phase * 2.0 * math.Pi
+		applyHeat(dst, img, radians, opts.HeatAmplitude, max(opts.pixelScale, 1), sample)
+		return bounds, nil
+
+	case "kenburns":
+		// Move the crop window's center and zoom together from their
+		// start to end values
+		progress := effectProgress(frameIdx, frameCount, opts.LoopSmooth)
+		lerp := func(from, to float64) float64 { return from + (to-from)*progress }
+		zoom := lerp(opts.KenBurnsZoom[0], opts.KenBurnsZoom[1])
+		anchorX := lerp(opts.KenBurnsFrom[0], opts.KenBurnsTo[0])
+		anchorY := lerp(opts.KenBurnsFrom[1], opts.KenBurnsTo[1])
+		applyKenBurns(dst, img, zoom, anchorX, anchorY, sample)
+		return bounds, nil
+
+	case "reflect":
+		radians := phase * 2.0 * math.Pi
+		applyReflect(dst, img, radians, opts.ReflectRipple, max(opts.pixelScale, 1), sample)
+		return bounds, nil
+
+	case "morph":
+		if opts.Image2 == nil {
+			return image.Rectangle{}, fmt.Errorf("morph requires a second image")
+		}
+		progress := effectProgress(frameIdx, frameCount, opts.LoopSmooth)
+		blendImages(dst, img, opts.Image2, progress)
+		return bounds, nil
+
+	case "gradientmap":
+		// Cycling sweeps the gradient up through the tones and back down,
+		// a shift of 2, over the loop
+		shift := 0.0
+		if opts.GradientCycle {
+			shift = phase * 2.0
+		}
+		applyGradientMap(dst, img, opts.GradientStops, shift)
+		return bounds, nil
+
+	case "bounce":
+		height := float64(bounds.Dy())
+		drop, impact := bounceCurve(phase)
+		offsetY := -int(math.Round(opts.BounceHeight * height * drop))
+		squash := 0.2 * impact
+		applyBounce(dst, img, offsetY, squash, sample)
+		return bounds, nil
+
+	case "jelly":
+		applyJelly(dst, img, phase, opts.JellyStiffness, opts.JellyDamping, edgeSampler(sample, "transparent"))
+		return bounds, nil
+
+	case "ascii":
+		// Slide the grid diagonally by one cell over the loop, so the
+		// glyphs shimmer and line up again on the first frame
+		shift := int(phase * float64(opts.ASCIICell))
+		glyphs := opts.asciiGlyphs
+		if glyphs == nil {
+			glyphs = asciiGlyphs(opts.ASCIIRamp, opts.ASCIICell)
+		}
+		applyASCII(dst, img, opts.ASCIICell, glyphs, image.Pt(shift, shift))
+		return bounds, nil
+
+	case "tile":
+		// Scroll diagonally by one tile over the loop, so the pattern
+		// lines up again on the first frame
+		offsetX := int(math.Round(phase * float64(bounds.Dx()) / float64(opts.TileCount)))
+		offsetY := int(math.Round(phase * float64(bounds.Dy()) / float64(opts.TileCount)))
+		applyTile(dst, img, opts.TileCount, opts.TileCount, offsetX, offsetY)
+		return bounds, nil
+
+	case "grow":
+		progress := effectProgress(frameIdx, frameCount, opts.LoopSmooth)
+		if frameCount <= 1 {
+			// A single frame shows the image fully grown rather than
+			// at its starting size, which may be nothing at all
+			progress = 1
+		}
+		applyGrow(dst, img, opts.GrowFrom+(1-opts.GrowFrom)*progress)
+		return bounds, nil
+
+	case "zoomblur":
+		progress := effectProgress(frameIdx, frameCount, opts.LoopSmooth)
+		strength := opts.ZoomBlurStrength * progress
+		if strength <= 0 {
+			draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+			return image.Rectangle{}, nil
+		}
+		// Take about one copy per pixel of the longest streak, at the
+		// corners, so the streaks are smooth rather than ghosted
+		streak := (1 - 1/(1+strength)) * math.Hypot(float64(bounds.Dx()), float64(bounds.Dy())) / 2
+		samples := max(2, min(32, int(math.Ceil(streak))+1))
+		applyZoomBlur(dst, img, strength, samples, sample)
+		return bounds, nil
+
+	case "mirrortile":
+		// Slide the mirrored quarter from the top-left corner to the
+		// bottom-right one and back, easing at each end
+		radians := phase * 2.0 * math.Pi
+		travel := (1 - math.Cos(radians)) / 2
+		offsetX := int(math.Round(travel * float64(bounds.Dx()/2)))
+		offsetY := int(math.Round(travel * float64(bounds.Dy()/2)))
+		applyMirrorTile(dst, img, offsetX, offsetY)
+		return bounds, nil
+
+	case "channel":
+		order := opts.ChannelOrder
+		if len(order) == 0 {
+			order = [][3]bool{{true, false, false}, {false, true, false}, {false, false, true}, {true, true, false}, {false, true, true}, {true, false, true}, {true, true, true}}
+		}
+		channels := order[frameIdx%len(order)]
+		applyChannelMask(dst, img, channels[0], channels[1], channels[2])
+		return bounds, nil
+
+	case "outline":
+		stroke := opts.OutlineColor
+		if opts.OutlineCycle {
+			hue := phase * 360.0
+			r, g, b := hsvToRGB(hue, 1.0, 1.0)
+			stroke = color.RGBA{r, g, b, 255}
+		}
+		applyOutline(dst, img, stroke, opts.OutlineWidth)
+		return bounds, nil
+
+	case "rgbjitter":
+		// Each channel circles around its true position, a third of a
+		// turn apart, so the channels separate in different directions
+		radians := phase * 2.0 * math.Pi
+		amount := float64(opts.JitterAmount)
+		offsets := make([]image.Point, 3)
+		for i := range offsets {
+			angle := radians + float64(i)*2.0*math.Pi/3.0
+			offsets[i] = image.Pt(int(math.Round(amount*math.Cos(angle))), int(math.Round(amount*math.Sin(angle))))
+		}
+		applyRGBJitter(dst, img, offsets[0], offsets[1], offsets[2])
+		return bounds, nil
+
+	case "cmyk":
+		// The cyan, magenta and yellow plates drift back and forth along
+		// their halftone screen angles, a third of a cycle apart, against
+		// the black plate, which stays put
+		radians := phase * 2.0 * math.Pi
+		amount := float64(opts.CMYKOffset)
+		var offsets [4]image.Point
+		for i, screen := range []float64{15, 75, 0} {
+			drift := amount * math.Sin(radians+float64(i)*2.0*math.Pi/3.0)
+			angle := screen * math.Pi / 180.0
+			offsets[i] = image.Pt(int(math.Round(drift*math.Cos(angle))), int(math.Round(drift*math.Sin(angle))))
+		}
+		applyCMYKShift(dst, img, offsets)
+		return bounds, nil
+
+	case "vibes":
+		width := bounds.Dx()
+		height := bounds.Dy()
+		colors := []color.RGBA{
+			{255, 20, 147, 255}, // Hot Pink/Magenta
+			{255, 255, 0, 255},  // Bright Yellow
+			{50, 255, 50, 255},  // Bright Lime Green
+			{0, 200, 255, 255},  // Bright Cyan Blue
+		}
+		// Draw base image first
+		draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+		// Apply tints to quarters
+		var tints [4]color.RGBA
+		for quarter := 0; quarter < 4; quarter++ {
+			colorIndex := (frameIdx + quarter) % 4
+			tintColor := colors[colorIndex]
+			if opts.VibesSmooth {
+				// Glide once around the hue wheel over the loop, with the
+				// quarters a quarter turn apart
+				hue := math.Mod(phase*360.0+float64(quarter)*90.0, 360.0)
+				r, g, b := hsvToRGB(hue, 1.0, 1.0)
+				tintColor = color.RGBA{r, g, b, 255}
+			}
+			tints[quarter] = tintColor
+			if opts.VibesFeather > 0 {
+				continue
+			}
+			var startX, endX, startY, endY int
+			switch quarter {
+			case 0: // Top-left
+				startX = bounds.Min.X
+				endX = bounds.Min.X + width/2
+				startY = bounds.Min.Y
+				endY = bounds.Min.Y + height/2
+			case 1: // Top-right
+				startX = bounds.Min.X + width/2
+				endX = bounds.Max.X
+				startY = bounds.Min.Y
+				endY = bounds.Min.Y + height/2
+			case 2: // Bottom-left
+				startX = bounds.Min.X
+				endX = bounds.Min.X + width/2
+				startY = bounds.Min.Y + height/2
+				endY = bounds.Max.Y
+			case 3: // Bottom-right
+				startX = bounds.Min.X + width/2
+				endX = bounds.Max.X
+				startY = bounds.Min.Y + height/2
+				endY = bounds.Max.Y
+			}
+			applyTintToRegion(dst, img, tintColor, startX, endX, startY, endY)
+		}
+		if opts.VibesFeather > 0 {
+			applyFeatheredTints(dst, img, tints, opts.VibesFeather)
+		}
+		return bounds, nil
+
+	case "kaleidoscope":
+		centerX, centerY, _ := effectCenter(bounds, opts.Center)
+		rotationAngle := phase * 2.0 * math.Pi
+		applyKaleidoscope(dst, img, centerX, centerY, rotationAngle, opts.KaleidoscopeZoom, opts.KaleidoscopeReflect, sample)
+		return bounds, nil
+
+	case "ripple":
+		centerX, centerY, maxDistance := effectCenter(bounds, opts.Center)
+		radians := phase * 2.0 * math.Pi
+		sample = edgeSampler(sample, opts.RippleEdge)
+		if opts.RippleMode == "linear" {
+			angle := opts.RippleAngle * math.Pi / 180.0
+			applyLinearRipple(dst, img, centerX, centerY, radians, angle, max(opts.pixelScale, 1), sample)
+		} else {
+			applyRipple(dst, img, centerX, centerY, radians, maxDistance, max(opts.pixelScale, 1), sample)
+		}
+		return bounds, nil
+
+	default:
+		return image.Rectangle{}, fmt.Errorf("unknown subcommand: %s", subcommand)
+	}
+}
+
+// effectCenter returns the center of a radial effect in pixel coordinates
+// relative to the image's top-left corner, given as fractions of the image
+// size, and the distance from it to the farthest corner of the image.
+func effectCenter(bounds image.Rectangle, center [2]float64) (cx, cy, maxDistance float64) {
+	width := float64(bounds.Dx())
+	height := float64(bounds.Dy())
+	cx = center[0] * width
+	cy = center[1] * height
+	dx := math.Max(cx, width-cx)
+	dy := math.Max(cy, height-cy)
+	return cx, cy, math.Sqrt(dx*dx + dy*dy)
+}
+
+// effectProgress returns how far a progressive effect has advanced at the
+// given frame, from 0 to 1. By default progress ramps linearly from the first
+// frame to the last. With loopSmooth, progress follows a cosine curve that
+// peaks halfway through and returns towards 0, so the last frame leads back
+// into the first without a jump.
+func effectProgress(frameIdx, frameCount int, loopSmooth bool) float64 {
+	if loopSmooth {
+		return (1.0 - math.Cos(2.0*math.Pi*float64(frameIdx)/float64(frameCount))) / 2.0
+	}
+	return frameProgress(frameIdx, frameCount)
+}
+
+// frameProgress returns how far frame idx is through count frames, from 0 on
+// the first to 1 on the last. A single frame (or none) is at 0, rather than
+// dividing by zero.
+func frameProgress(idx, count int) float64 {
+	if count <= 1 {
+		return 0
+	}
+	return float64(idx) / float64(count-1)
+}
+
+// validEasing reports whether name is a known easing curve.
+func validEasing(name string) bool {
+	switch name {
+	case "linear", "ease-in", "ease-out", "ease-in-out":
+		return true
+	}
+	return false
+}
+
+// applyEasing maps linear progress t (0 to 1) through the named easing curve.
+// ease-in starts slow and speeds up, ease-out starts fast and slows down, and
+// ease-in-out does both. All curves map 0 to 0 and 1 to 1.
+func applyEasing(name string, t float64) float64 {
+	switch name {
+	case "ease-in":
+		return t * t * t
+	case "ease-out":
+		return 1 - math.Pow(1-t, 3)
+	case "ease-in-out":
+		if t < 0.5 {
+			return 4 * t * t * t
+		}
+		return 1 - math.Pow(-2*t+2, 3)/2
+	default:
+		return t
+	}
+}
+
+// LoadImage loads an image file, decoding it as LoadImageFromReader does.
+func LoadImage(filename string, autorotate bool) (image.Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return LoadImageFromReader(file, autorotate)
+}
+
+// IsURL reports whether the input path is an http or https URL.
+func IsURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// maxURLBytes is the largest image LoadImageFromURL downloads, so that a
+// huge or endless response can't exhaust memory.
+var maxURLBytes int64 = 50 << 20
+
+// LoadImageFromURL fetches an image over http or https, giving up after
+// timeout or once it is larger than 50 MB, and decodes it as
+// LoadImageFromReader does.
+func LoadImageFromURL(url string, timeout time.Duration, autorotate bool) (image.Image, error) {
+	client := &http.Client{Timeout: timeout}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "animoji/"+Version)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch image: %s returned %s", url, resp.Status)
+	}
+
+	tooLarge := fmt.Errorf("failed to fetch image: %s is larger than the %d MB limit", url, maxURLBytes>>20)
+	if resp.ContentLength > maxURLBytes {
+		return nil, tooLarge
+	}
+
+	// Read one byte past the limit to tell a body of exactly the limit from
+	// a larger one, which may not have given its length
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxURLBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %w", err)
+	}
+	if int64(len(data)) > maxURLBytes {
+		return nil, tooLarge
+	}
+
+	return LoadImageFromReader(bytes.NewReader(data), autorotate)
+}
+
+// LoadImageFromReader decodes an image. If autorotate is set, JPEG images
+// are rotated and flipped according to their EXIF orientation tag.
+func LoadImageFromReader(r io.Reader, autorotate bool) (image.Image, error) {
+	// Buffer the input so the EXIF data can be read separately
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	// Check the format before decoding to give a helpful error
+	format, err := checkImageFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeImage(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if autorotate && format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	return img, nil
+}
+
+// LoadRawImage reads an image of the given size from raw, non-premultiplied
+// RGBA bytes, 4 per pixel in rows from the top left, as written by other
+// renderers. It reads stdin if filename is empty.
+func LoadRawImage(filename string, size image.Point) (image.Image, error) {
+	r := io.Reader(os.Stdin)
+	if filename != "" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raw image: %w", err)
+	}
+	if expected := int64(size.X) * int64(size.Y) * 4; int64(len(data)) != expected {
+		return nil, fmt.Errorf("raw image is %d bytes, expected %d for %dx%d RGBA", len(data), expected, size.X, size.Y)
+	}
+
+	return &image.NRGBA{Pix: data, Stride: size.X * 4, Rect: image.Rectangle{Max: size}}, nil
+}
+
+// supportedFormats lists the input formats that can be decoded.
+var supportedFormats = []string{"png", "jpeg", "gif", "bmp", "tiff", "webp"}
+
+// checkImageFormat identifies the format of encoded image data, returning a
+// descriptive error if it is empty or unsupported.
+func checkImageFormat(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", fmt.Errorf("input is empty")
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == image.ErrFormat {
+		supported := strings.Join(supportedFormats, ", ")
+		if name := sniffFormat(data); name != "" {
+			return "", fmt.Errorf("unsupported format '%s'; supported: %s", name, supported)
+		}
+		return "", fmt.Errorf("unrecognized image format; supported: %s", supported)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image header: %w", err)
+	}
+	return format, nil
+}
+
+// decodeImage decodes data, which checkImageFormat found to be in format.
+// A GIF is decoded whole, both to reject animations, since only the first
+// frame would be used, and to return that frame without decoding it again.
+func decodeImage(data []byte, format string) (image.Image, error) {
+	if format != "gif" {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s image: %w", format, err)
+		}
+		return img, nil
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode gif image: %w", err)
+	}
+	if len(anim.Image) > 1 {
+		return nil, fmt.Errorf("input is an animated GIF (%d frames); only still images are supported", len(anim.Image))
+	}
+	return anim.Image[0], nil
+}
+
+// sniffFormat names common image formats that can't be decoded, based on
+// their leading magic bytes. It returns "" if the format isn't recognized.
+func sniffFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("BM")):
+		return "bmp"
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return "tiff"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "webp"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && (string(data[8:12]) == "heic" || string(data[8:12]) == "heix" || string(data[8:12]) == "mif1"):
+		return "heic"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && string(data[8:12]) == "avif":
+		return "avif"
+	case bytes.Contains(data[:min(len(data), 512)], []byte("<svg")):
+		return "svg"
+	}
+	return ""
+}
+
+// LoadPalette loads the colors of a palette file: a GIMP .gpl palette, or
+// any other image, whose distinct pixel colors are taken in reading order. A
+// palette must have from 1 to 256 colors.
+func LoadPalette(filename string) (color.Palette, error) {
+	var palette color.Palette
+	var err error
+	if strings.EqualFold(filepath.Ext(filename), ".gpl") {
+		palette, err = loadGPL(filename)
+	} else {
+		var img image.Image
+		img, err = LoadImage(filename, false)
+		if err == nil {
+			palette = imageColors(img, 257)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(palette) == 0 || len(palette) > 256 {
+		count := fmt.Sprint(len(palette))
+		if len(palette) > 256 {
+			count = "more than 256"
+		}
+		return nil, fmt.Errorf("%s has %s colors (expected 1 to 256)", filename, count)
+	}
+	return palette, nil
+}
+
+// imageColors returns the distinct colors of img's pixels in reading order,
+// stopping once it has found limit colors.
+func imageColors(img image.Image, limit int) color.Palette {
+	bounds := img.Bounds()
+	seen := make(map[color.RGBA]bool)
+	var palette color.Palette
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			palette = append(palette, c)
+			if len(palette) >= limit {
+				return palette
+			}
+		}
+	}
+	return palette
+}
+
+// loadGPL reads the colors of a GIMP palette file. After the "GIMP Palette"
+// header, each line holds the red, green and blue values of a color from 0
+// to 255, optionally followed by a name. Name and Columns lines, comments
+// starting with # and blank lines are skipped.
+func loadGPL(filename string) (color.Palette, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if strings.TrimSpace(lines[0]) != "GIMP Palette" {
+		return nil, fmt.Errorf("%s is not a GIMP palette (missing the \"GIMP Palette\" header)", filename)
+	}
+
+	var palette color.Palette
+	for i, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "Name:") || strings.HasPrefix(line, "Columns:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s line %d: expected red, green and blue values (got '%s')", filename, i+2, line)
+		}
+		var rgb [3]uint8
+		for j := range rgb {
+			v, err := strconv.Atoi(fields[j])
+			if err != nil || v < 0 || v > 255 {
+				return nil, fmt.Errorf("%s line %d: color values must be from 0 to 255 (got '%s')", filename, i+2, fields[j])
+			}
+			rgb[j] = uint8(v)
+		}
+		palette = append(palette, color.RGBA{rgb[0], rgb[1], rgb[2], 255})
+	}
+	return palette, nil
+}
+
+// ToGray converts an image to 8-bit grayscale by luminance, with its bounds
+// moved to the origin.
+func ToGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+	return gray
+}
+
+// PlaceOnCanvas returns a canvas of the given size filled with background,
+// with img centered on it. An image larger than the canvas is cropped.
+func PlaceOnCanvas(img image.Image, size image.Point, background color.Color) *image.RGBA {
+	canvas := image.NewRGBA(image.Rectangle{Max: size})
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	bounds := img.Bounds()
+	offset := size.Sub(bounds.Size()).Div(2)
+	draw.Draw(canvas, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Src)
+	return canvas
+}
+
+// ToRGBA converts an image to *image.RGBA with bounds starting at the origin.
+func ToRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// CropImage returns the part of img within rect, with its bounds moved to the
+// origin.
+func CropImage(img image.Image, rect image.Rectangle) *image.RGBA {
+	rect = rect.Intersect(img.Bounds())
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
+	return cropped
+}
+
+// TrimBounds returns the bounds of img without its border of background
+// pixels, found by scanning rows and columns inward from each edge until a
+// pixel differs from bg by more than tolerance in any channel. A transparent
+// bg matches every pixel with alpha of at most tolerance. If the whole image
+// is background, its full bounds are returned.
+func TrimBounds(img image.Image, bg color.Color, tolerance int) image.Rectangle {
+	bounds := img.Bounds()
+	background := color.RGBAModel.Convert(bg).(color.RGBA)
+	diff := func(a, b uint8) int { return max(int(a)-int(b), int(b)-int(a)) }
+	isBackground := func(x, y int) bool {
+		c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+		return diff(c.R, background.R) <= tolerance && diff(c.G, background.G) <= tolerance &&
+			diff(c.B, background.B) <= tolerance && diff(c.A, background.A) <= tolerance
+	}
+	rowIsBackground := func(y, minX, maxX int) bool {
+		for x := minX; x < maxX; x++ {
+			if !isBackground(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	columnIsBackground := func(x, minY, maxY int) bool {
+		for y := minY; y < maxY; y++ {
+			if !isBackground(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	trimmed := bounds
+	for trimmed.Min.Y < trimmed.Max.Y && rowIsBackground(trimmed.Min.Y, trimmed.Min.X, trimmed.Max.X) {
+		trimmed.Min.Y++
+	}
+	if trimmed.Empty() {
+		return bounds
+	}
+	for rowIsBackground(trimmed.Max.Y-1, trimmed.Min.X, trimmed.Max.X) {
+		trimmed.Max.Y--
+	}
+	for columnIsBackground(trimmed.Min.X, trimmed.Min.Y, trimmed.Max.Y) {
+		trimmed.Min.X++
+	}
+	for columnIsBackground(trimmed.Max.X-1, trimmed.Min.Y, trimmed.Max.Y) {
+		trimmed.Max.X--
+	}
+	return trimmed
+}
+
+// ResizeImage scales img to targetWidth pixels wide, with the height scaled
+// proportionally (at least 1 pixel).
+func ResizeImage(img image.Image, targetWidth int) (image.Image, error) {
+	bounds := img.Bounds()
+	srcWidth := bounds.Dx()
+	srcHeight := bounds.Dy()
+
+	if srcWidth == 0 || srcHeight == 0 {
+		return nil, fmt.Errorf("source image has zero dimensions")
+	}
+
+	// Calculate target height maintaining aspect ratio, keeping at least one
+	// row so a wide strip doesn't shrink to an empty image
+	targetHeight := max(1, int(float64(targetWidth)*float64(srcHeight)/float64(srcWidth)))
+
+	// Create new RGBA image with target dimensions
+	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+
+	// Scale factors
+	scaleX := float64(srcWidth) / float64(targetWidth)
+	scaleY := float64(srcHeight) / float64(targetHeight)
+
+	// Resize using nearest neighbor sampling
+	for y := 0; y < targetHeight; y++ {
+		for x := 0; x < targetWidth; x++ {
+			// Map destination pixel to source coordinates
+			srcX := int(float64(x) * scaleX)
+			srcY := int(float64(y) * scaleY)
+
+			// Clamp to source bounds
+			if srcX >= srcWidth {
+				srcX = srcWidth - 1
+			}
+			if srcY >= srcHeight {
+				srcY = srcHeight - 1
+			}
+
+			// Get pixel from source
+			dst.Set(x, y, img.At(srcX+bounds.Min.X, srcY+bounds.Min.Y))
+		}
+	}
+
+	return dst, nil
+}
+
+// upscaleImage enlarges the image by an integer factor using nearest neighbor sampling.
+func upscaleImage(img image.Image, factor int) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx()*factor, bounds.Dy()*factor))
+
+	for y := 0; y < bounds.Dy()*factor; y++ {
+		for x := 0; x < bounds.Dx()*factor; x++ {
+			dst.Set(x, y, img.At(bounds.Min.X+x/factor, bounds.Min.Y+y/factor))
+		}
+	}
+
+	return dst
+}
+
+// downscaleArea shrinks the image by an integer factor into dst, setting each
+// destination pixel to the average of the factor x factor block it covers.
+// dst must be at least 1/factor the size of img.
+func downscaleArea(dst *image.RGBA, img image.Image, factor int) {
+	bounds := img.Bounds()
+	dstWidth := bounds.Dx() / factor
+	dstHeight := bounds.Dy() / factor
+	samples := uint32(factor * factor)
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			// Average all source pixels in this block
+			var rSum, gSum, bSum, aSum uint32
+			for sy := 0; sy < factor; sy++ {
+				for sx := 0; sx < factor; sx++ {
+					r, g, b, a := img.At(bounds.Min.X+x*factor+sx, bounds.Min.Y+y*factor+sy).RGBA()
+					rSum += r >> 8
+					gSum += g >> 8
+					bSum += b >> 8
+					aSum += a >> 8
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				uint8(rSum / samples),
+				uint8(gSum / samples),
+				uint8(bSum / samples),
+				uint8(aSum / samples),
+			})
+		}
+	}
+
+}
+
+func applyHueShift(dst *image.RGBA, src image.Image, hueShift float64) {
+	bounds := src.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Fully transparent pixels have no meaningful color to shift
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				dst.Set(x, y, src.At(x, y))
+				continue
+			}
+
+			// Convert the unpremultiplied color to HSV, so partially
+			// transparent pixels keep their true hue and saturation
+			h, s, v := rgbToHSV(c.R, c.G, c.B)
+
+			// Shift hue
+			h = math.Mod(h+hueShift, 360.0)
+			if h < 0 {
+				h += 360.0
+			}
+
+			// Convert back to RGB
+			rNew, gNew, bNew := hsvToRGB(h, s, v)
+
+			dst.Set(x, y, color.NRGBA{rNew, gNew, bNew, c.A})
+		}
+	}
+}
+
+// applyRecolor shifts the hue of the pixels whose hue lies between low and
+// high degrees, leaving other pixels unchanged. If low is greater than high
+// the band wraps through 0, so 330 to 30 selects reds. Grays have no hue and
+// are never shifted.
+func applyRecolor(dst *image.RGBA, src image.Image, hueShift, low, high float64) {
+	bounds := src.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			h, s, v := rgbToHSV(c.R, c.G, c.B)
+
+			inRange := h >= low && h <= high
+			if low > high {
+				inRange = h >= low || h <= high
+			}
+			if c.A == 0 || s == 0 || !inRange {
+				dst.Set(x, y, src.At(x, y))
+				continue
+			}
+
+			h = math.Mod(h+hueShift, 360.0)
+			rNew, gNew, bNew := hsvToRGB(h, s, v)
+			dst.Set(x, y, color.NRGBA{rNew, gNew, bNew, c.A})
+		}
+	}
+}
+
+// applyChannelMask copies src into dst keeping only the red, green and blue
+// channels that are enabled and zeroing the others. Alpha is unchanged.
+func applyChannelMask(dst *image.RGBA, src image.Image, r, g, b bool) {
+	bounds := src.Bounds()
+	keep := func(v uint8, on bool) uint8 {
+		if on {
+			return v
+		}
+		return 0
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(src.At(x, y)).(color.RGBA)
+			dst.SetRGBA(x, y, color.RGBA{keep(c.R, r), keep(c.G, g), keep(c.B, b), c.A})
+		}
+	}
+}
+
+func rgbToHSV(r, g, b uint8) (h, s, v float64) {
+	rf := float64(r) / 255.0
+	gf := float64(g) / 255.0
+	bf := float64(b) / 255.0
+
+	max := math.Max(math.Max(rf, gf), bf)
+	min := math.Min(math.Min(rf, gf), bf)
+	delta := max - min
+
+	// Value
+	v = max
+
+	// Saturation
+	if max == 0 {
+		s = 0
+	} else {
+		s = delta / max
+	}
+
+	// Hue
+	if delta == 0 {
+		h = 0
+	} else if max == rf {
+		h = 60.0 * math.Mod((gf-bf)/delta+6.0, 6.0)
+	} else if max == gf {
+		h = 60.0 * ((bf-rf)/delta + 2.0)
+	} else {
+		h = 60.0 * ((rf-gf)/delta + 4.0)
+	}
+
+	if h < 0 {
+		h += 360.0
+	}
+
+	return h, s, v
+}
+
+func hsvToRGB(h, s, v float64) (r, g, b uint8) {
+	c := v * s
+	x := c * (1.0 - math.Abs(math.Mod(h/60.0, 2.0)-1.0))
+	m := v - c
+
+	var rf, gf, bf float64
+
+	switch {
+	case h < 60:
+		rf, gf, bf = c, x, 0
+	case h < 120:
+		rf, gf, bf = x, c, 0
+	case h < 180:
+		rf, gf, bf = 0, c, x
+	case h < 240:
+		rf, gf, bf = 0, x, c
+	case h < 300:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+
+	r = uint8(math.Round((rf + m) * 255.0))
+	g = uint8(math.Round((gf + m) * 255.0))
+	b = uint8(math.Round((bf + m) * 255.0))
+
+	return r, g, b
+}
+
+func applyZoom(dst *image.RGBA, src image.Image, zoom float64, sample sampleFunc) {
+	dstBounds := dst.Bounds()
+	dstWidth := float64(dstBounds.Dx())
+	dstHeight := float64(dstBounds.Dy())
+
+	srcBounds := src.Bounds()
+	srcMinX, srcMinY, srcRegionWidth, srcRegionHeight := zoomRegion(srcBounds, zoom)
+
+	// For each pixel in destination, find corresponding pixel in source
+	for y := 0; y < dstBounds.Dy(); y++ {
+		for x := 0; x < dstBounds.Dx(); x++ {
+			// Map destination pixel to source coordinates
+			srcX := srcMinX + (float64(x)/dstWidth)*srcRegionWidth
+			srcY := srcMinY + (float64(y)/dstHeight)*srcRegionHeight
+
+			// The sampled region always lies within the source
+			dst.Set(x+dstBounds.Min.X, y+dstBounds.Min.Y, sample(src, srcX+float64(srcBounds.Min.X), srcY+float64(srcBounds.Min.Y)))
+		}
+	}
+}
+
+// zoomRegion returns the top-left corner, relative to the source's own, and
+// the size of the centered region of the source that fills the frame when
+// zoomed in by zoom.
+func zoomRegion(srcBounds image.Rectangle, zoom float64) (minX, minY, width, height float64) {
+	srcWidth := float64(srcBounds.Dx())
+	srcHeight := float64(srcBounds.Dy())
+
+	// Calculate the source region to sample from (centered)
+	width = srcWidth / zoom
+	height = srcHeight / zoom
+	srcCenterX := srcWidth / 2.0
+	srcCenterY := srcHeight / 2.0
+
+	minX = srcCenterX - width/2.0
+	minY = srcCenterY - height/2.0
+	return minX, minY, width, height
+}
+
+// applyZoomBlur blurs src radially outward from its center, like a camera
+// zooming during the exposure, by averaging samples copies zoomed in from 1
+// (the image itself) up to 1+strength. samples must be at least 2.
+func applyZoomBlur(dst *image.RGBA, src image.Image, strength float64, samples int, sample sampleFunc) {
+	dstBounds := dst.Bounds()
+	dstWidth := float64(dstBounds.Dx())
+	dstHeight := float64(dstBounds.Dy())
+	srcBounds := src.Bounds()
+
+	type region struct{ minX, minY, width, height float64 }
+	regions := make([]region, samples)
+	for i := range regions {
+		zoom := 1 + strength*float64(i)/float64(samples-1)
+		r := &regions[i]
+		r.minX, r.minY, r.width, r.height = zoomRegion(srcBounds, zoom)
+	}
+
+	for y := 0; y < dstBounds.Dy(); y++ {
+		for x := 0; x < dstBounds.Dx(); x++ {
+			var r, g, b, a float64
+			for _, region := range regions {
+				srcX := region.minX + (float64(x)/dstWidth)*region.width
+				srcY := region.minY + (float64(y)/dstHeight)*region.height
+				c := sample(src, srcX+float64(srcBounds.Min.X), srcY+float64(srcBounds.Min.Y))
+				r += float64(c.R)
+				g += float64(c.G)
+				b += float64(c.B)
+				a += float64(c.A)
+			}
+			n := float64(samples)
+			dst.SetRGBA(x+dstBounds.Min.X, y+dstBounds.Min.Y, color.RGBA{clamp8(r/n + 0.5), clamp8(g/n + 0.5), clamp8(b/n + 0.5), clamp8(a/n + 0.5)})
+		}
+	}
+}
+
+// applyPixelate replaces blocks of the image with their average color. The
+// shape selects the mosaic: "square" fills a grid of square blocks, "circle"
+// fills a disc centered in each block and leaves the corners as the original
+// image, and "hex" offsets alternate rows by half a block for a honeycomb-like
+// layout.
+func applyPixelate(dst *image.RGBA, src image.Image, blockSize float64, shape string) {
+	bounds := src.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Circles leave the corners of each block showing the original
+	if shape == "circle" {
+		draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	}
+
+	// Calculate number of blocks based on block size. Blocks are at least a
+	// pixel, and there is always at least one, even for a tiny image
+	blockSize = math.Max(blockSize, 1.0)
+	blocksX := max(1, int(math.Ceil(float64(width)/blockSize)))
+	blocksY := max(1, int(math.Ceil(float64(height)/blockSize)))
+	radius := blockSize / 2.0
+
+	// Process each block
+	for blockY := 0; blockY < blocksY; blockY++ {
+		// Shift alternate rows by half a block for hex, adding a block at
+		// the start of the row to cover the gap
+		offsetX := 0.0
+		firstBlockX := 0
+		if shape == "hex" && blockY%2 == 1 {
+			offsetX = blockSize / 2.0
+			firstBlockX = -1
+		}
+
+		for blockX := firstBlockX; blockX < blocksX; blockX++ {
+			// Calculate block boundaries
+			startX := int(offsetX + float64(blockX)*blockSize)
+			startY := int(float64(blockY) * blockSize)
+			endX := int(offsetX + float64(blockX+1)*blockSize)
+			endY := int(float64(blockY+1) * blockSize)
+
+			// Clamp to bounds
+			if startX < bounds.Min.X {
+				startX = bounds.Min.X
+			}
+			if startY < bounds.Min.Y {
+				startY = bounds.Min.Y
+			}
+			if endX > bounds.Max.X {
+				endX = bounds.Max.X
+			}
+			if endY > bounds.Max.Y {
+				endY = bounds.Max.Y
+			}
+
+			// Fill the block with its average color, only within the disc
+			// centered in the block for circles
+			block := image.Rectangle{Min: image.Pt(startX, startY), Max: image.Pt(endX, endY)}
+			if blockColor, ok := blockAverage(src, block); ok {
+				centerX := offsetX + (float64(blockX)+0.5)*blockSize
+				centerY := (float64(blockY) + 0.5) * blockSize
+				for y := startY; y < endY; y++ {
+					for x := startX; x < endX; x++ {
+						if shape == "circle" {
+							dx := float64(x) + 0.5 - centerX
+							dy := float64(y) + 0.5 - centerY
+							if dx*dx+dy*dy > radius*radius {
+								continue
+							}
+						}
+						dst.Set(x, y, blockColor)
+					}
+				}
+			}
+		}
+	}
+}
+
+// blockAverage returns the average premultiplied color of the pixels of src
+// within r, or false if r is empty.
+func blockAverage(src image.Image, r image.Rectangle) (color.RGBA, bool) {
+	if r.Empty() {
+		return color.RGBA{}, false
+	}
+
+	var rSum, gSum, bSum, aSum uint64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r, g, b, a := src.At(x, y).RGBA()
+			rSum += uint64(r >> 8)
+			gSum += uint64(g >> 8)
+			bSum += uint64(b >> 8)
+			aSum += uint64(a >> 8)
+		}
+	}
+
+	n := uint64(r.Dx() * r.Dy())
+	return color.RGBA{uint8(rSum / n), uint8(gSum / n), uint8(bSum / n), uint8(aSum / n)}, true
+}
+
+// applyASCII renders src as colored text on a black background. The image
+// is divided into cellSize square cells, starting offset pixels from the top
+// left so that moving the grid makes the text shimmer, and each cell becomes
+// the glyph matching its average brightness, from the first of glyphs (as
+// built by asciiGlyphs) for the darkest cells to the last for the brightest,
+// drawn in the cell's average color. Transparent areas stay transparent.
+func applyASCII(dst *image.RGBA, src image.Image, cellSize int, glyphs [][]uint8, offset image.Point) {
+	bounds := dst.Bounds()
+
+	// Start a cell before the image if the grid is offset, so the edges are
+	// covered by partial cells
+	startX := bounds.Min.X - (cellSize-offset.X%cellSize)%cellSize
+	startY := bounds.Min.Y - (cellSize-offset.Y%cellSize)%cellSize
+	for cellY := startY; cellY < bounds.Max.Y; cellY += cellSize {
+		for cellX := startX; cellX < bounds.Max.X; cellX += cellSize {
+			cell := image.Rect(cellX, cellY, cellX+cellSize, cellY+cellSize).Intersect(bounds)
+			avg, ok := blockAverage(src, cell)
+			if !ok {
+				continue
+			}
+
+			// Pick the glyph by the brightness of the unpremultiplied color
+			level := 0
+			if avg.A > 0 {
+				lum := (0.299*float64(avg.R) + 0.587*float64(avg.G) + 0.114*float64(avg.B)) / float64(avg.A)
+				level = min(len(glyphs)-1, int(lum*float64(len(glyphs))))
+			}
+			coverage := glyphs[level]
+
+			// Blend the glyph color over black by the glyph's coverage,
+			// keeping the cell's alpha
+			for y := cell.Min.Y; y < cell.Max.Y; y++ {
+				for x := cell.Min.X; x < cell.Max.X; x++ {
+					c := uint32(coverage[(y-cellY)*cellSize+(x-cellX)])
+					dst.SetRGBA(x, y, color.RGBA{
+						R: uint8(uint32(avg.R) * c / 255),
+						G: uint8(uint32(avg.G) * c / 255),
+						B: uint8(uint32(avg.B) * c / 255),
+						A: avg.A,
+					})
+				}
+			}
+		}
+	}
+}
+
+// DefaultASCIIRamp is the default -ascii-ramp, from sparse to dense.
+const DefaultASCIIRamp = " .:-=+*#%@"
+
+// asciiShades maps the Unicode shade block characters, which the built-in
+// font lacks, to the fraction of pixels they fill.
+var asciiShades = map[rune]int{
+	'░': 1,
+	'▒': 2,
+	'▓': 3,
+	'█': 4,
+}
+
+// ParseASCIIRamp parses the characters of an -ascii-ramp, each of which must
+// be printable ASCII, which the built-in font has, or a shade block.
+func ParseASCIIRamp(s string) ([]rune, error) {
+	ramp := []rune(s)
+	if err := checkASCIIRamp(ramp); err != nil {
+		return nil, err
+	}
+	return ramp, nil
+}
+
+// checkASCIIRamp reports an empty ramp or a character ascii can't draw.
+func checkASCIIRamp(ramp []rune) error {
+	if len(ramp) == 0 {
+		return fmt.Errorf("no characters")
+	}
+	for _, r := range ramp {
+		if _, ok := basicfont.Face7x13.GlyphAdvance(r); !ok && asciiShades[r] == 0 {
+			return fmt.Errorf("character %q is not printable ASCII or a shade block (░▒▓█)", r)
+		}
+	}
+	return nil
+}
+
+// asciiGlyphs returns the coverage, from 0 to 255, of each pixel of each of
+// the glyphs of ramp stretched to a cellSize square, in rows. Each pixel
+// averages 4x4 samples of the glyph so that small cells stay legible. Shade
+// blocks fill a quarter of the pixels per step in a fixed dot pattern.
+func asciiGlyphs(ramp []rune, cellSize int) [][]uint8 {
+	face := basicfont.Face7x13
+	height := face.Ascent + face.Descent
+	const samples = 4
+
+	glyphs := make([][]uint8, len(ramp))
+	for i, r := range ramp {
+		coverage := make([]uint8, cellSize*cellSize)
+		glyphs[i] = coverage
+		if shade := asciiShades[r]; shade > 0 {
+			for y := 0; y < cellSize; y++ {
+				for x := 0; x < cellSize; x++ {
+					// The order of each pixel in a 2x2 pattern
+					if [2][2]int{{0, 2}, {3, 1}}[y%2][x%2] < shade {
+						coverage[y*cellSize+x] = 255
+					}
+				}
+			}
+			continue
+		}
+
+		_, mask, maskp, _, ok := face.Glyph(fixed.P(0, face.Ascent), r)
+		if !ok {
+			continue
+		}
+
+		for y := 0; y < cellSize; y++ {
+			for x := 0; x < cellSize; x++ {
+				var sum uint32
+				for sy := 0; sy < samples; sy++ {
+					for sx := 0; sx < samples; sx++ {
+						gx := (x*samples + sx) * face.Width / (cellSize * samples)
+						gy := (y*samples + sy) * height / (cellSize * samples)
+						_, _, _, a := mask.At(maskp.X+gx, maskp.Y+gy).RGBA()
+						sum += a >> 8
+					}
+				}
+				coverage[y*cellSize+x] = uint8(sum / (samples * samples))
+			}
+		}
+	}
+	return glyphs
+}
+
+func applyTint(dst *image.RGBA, src image.Image, hue float64) {
+	bounds := src.Bounds()
+	opacity := 0.5 // 50% opacity
+
+	// Convert hue to RGB color
+	r, g, b := hsvToRGB(hue, 1.0, 1.0)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Get source pixel
+			srcR, srcG, srcB, srcA := src.At(x, y).RGBA()
+			srcR8 := uint8(srcR >> 8)
+			srcG8 := uint8(srcG >> 8)
+			srcB8 := uint8(srcB >> 8)
+			srcA8 := uint8(srcA >> 8)
+
+			// Blend tint color with source pixel at 50% opacity
+			// Formula: result = source * (1 - opacity) + tint * opacity
+			// Colors are premultiplied, so the tint is scaled by alpha too,
+			// leaving transparent pixels transparent
+			cover := float64(srcA8) / 255.0
+			blendR := clamp8(float64(srcR8)*(1.0-opacity) + float64(r)*opacity*cover)
+			blendG := clamp8(float64(srcG8)*(1.0-opacity) + float64(g)*opacity*cover)
+			blendB := clamp8(float64(srcB8)*(1.0-opacity) + float64(b)*opacity*cover)
+
+			dst.Set(x, y, color.RGBA{blendR, blendG, blendB, srcA8})
+		}
+	}
+}
+
+func applyTintToRegion(dst *image.RGBA, src image.Image, tintColor color.RGBA, startX, endX, startY, endY int) {
+	opacity := 0.5 // 50% opacity
+	tintR := float64(tintColor.R)
+	tintG := float64(tintColor.G)
+	tintB := float64(tintColor.B)
+
+	for y := startY; y < endY; y++ {
+		for x := startX; x < endX; x++ {
+			// Get source pixel
+			srcR, srcG, srcB, srcA := src.At(x, y).RGBA()
+			srcR8 := uint8(srcR >> 8)
+			srcG8 := uint8(srcG >> 8)
+			srcB8 := uint8(srcB >> 8)
+			srcA8 := uint8(srcA >> 8)
+
+			// Blend tint color with source pixel at 50% opacity, scaling
+			// the tint by alpha as the colors are premultiplied
+			cover := float64(srcA8) / 255.0
+			blendR := clamp8(float64(srcR8)*(1.0-opacity) + tintR*opacity*cover)
+			blendG := clamp8(float64(srcG8)*(1.0-opacity) + tintG*opacity*cover)
+			blendB := clamp8(float64(srcB8)*(1.0-opacity) + tintB*opacity*cover)
+
+			dst.Set(x, y, color.RGBA{blendR, blendG, blendB, srcA8})
+		}
+	}
+}
+
+// applyFeatheredTints tints the quarters of src like applyTintToRegion, with
+// tints in top-left, top-right, bottom-left, bottom-right order, but blends
+// neighboring tints across a band feather pixels wide centered on each
+// boundary so the quarters shade into each other without a seam.
+func applyFeatheredTints(dst *image.RGBA, src image.Image, tints [4]color.RGBA, feather int) {
+	opacity := 0.5 // 50% opacity
+	bounds := src.Bounds()
+	midX := bounds.Min.X + bounds.Dx()/2
+	midY := bounds.Min.Y + bounds.Dy()/2
+
+	// across returns how far pixel p is through the band around mid, from 0
+	// before it to 1 after it
+	across := func(p, mid int) float64 {
+		return math.Max(0, math.Min(1, (float64(p-mid)+0.5)/float64(feather)+0.5))
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		ty := across(y, midY)
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			tx := across(x, midX)
+			weights := [4]float64{(1 - tx) * (1 - ty), tx * (1 - ty), (1 - tx) * ty, tx * ty}
+			var tintR, tintG, tintB float64
+			for i, tint := range tints {
+				tintR += float64(tint.R) * weights[i]
+				tintG += float64(tint.G) * weights[i]
+				tintB += float64(tint.B) * weights[i]
+			}
+
+			srcR, srcG, srcB, srcA := src.At(x, y).RGBA()
+			cover := float64(srcA>>8) / 255.0
+			blendR := clamp8(float64(srcR>>8)*(1.0-opacity) + tintR*opacity*cover)
+			blendG := clamp8(float64(srcG>>8)*(1.0-opacity) + tintG*opacity*cover)
+			blendB := clamp8(float64(srcB>>8)*(1.0-opacity) + tintB*opacity*cover)
+
+			dst.Set(x, y, color.RGBA{blendR, blendG, blendB, uint8(srcA >> 8)})
+		}
+	}
+}
+
+// applySpotlight copies src into dst, blending the tint color at the given
+// opacity into a circular region centered at (cx, cy).
+func applySpotlight(dst *image.RGBA, src image.Image, cx, cy, radius float64, tint color.RGBA, opacity float64) {
+	bounds := src.Bounds()
+	tintR := float64(tint.R)
+	tintG := float64(tint.G)
+	tintB := float64(tint.B)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Copy pixels outside the circle unchanged
+			dx := float64(x) + 0.5 - cx
+			dy := float64(y) + 0.5 - cy
+			if dx*dx+dy*dy > radius*radius {
+				dst.Set(x, y, src.At(x, y))
+				continue
+			}
+
+			// Get source pixel
+			srcR, srcG, srcB, srcA := src.At(x, y).RGBA()
+			srcR8 := uint8(srcR >> 8)
+			srcG8 := uint8(srcG >> 8)
+			srcB8 := uint8(srcB >> 8)
+			srcA8 := uint8(srcA >> 8)
+
+			// Blend tint color with source pixel, scaling the tint by
+			// alpha as the colors are premultiplied
+			cover := float64(srcA8) / 255.0
+			blendR := clamp8(float64(srcR8)*(1.0-opacity) + tintR*opacity*cover)
+			blendG := clamp8(float64(srcG8)*(1.0-opacity) + tintG*opacity*cover)
+			blendB := clamp8(float64(srcB8)*(1.0-opacity) + tintB*opacity*cover)
+
+			dst.Set(x, y, color.RGBA{blendR, blendG, blendB, srcA8})
+		}
+	}
+}
+
+func applyKaleidoscope(dst *image.RGBA, src image.Image, cx, cy, rotationAngle, zoom float64, reflect bool, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Number of segments (like a kaleidoscope mirror)
+	segments := 8
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Translate to center
+			dx := float64(x) - cx
+			dy := float64(y) - cy
+
+			// Calculate angle and distance from center
+			angle := math.Atan2(dy, dx) + rotationAngle
+			distance := math.Sqrt(dx*dx + dy*dy)
+
+			// Map to one segment (0 to 2*pi/segments)
+			segmentAngle := math.Mod(angle, 2.0*math.Pi/float64(segments))
+			if segmentAngle < 0 {
+				segmentAngle += 2.0 * math.Pi / float64(segments)
+			}
+
+			// Mirror within the segment, so neighboring segments are
+			// reflections of each other rather than rotated copies
+			if reflect && segmentAngle > math.Pi/float64(segments) {
+				segmentAngle = 2.0*math.Pi/float64(segments) - segmentAngle
+			}
+
+			// Calculate source coordinates, scaling the sampled radius
+			// to zoom the pattern
+			srcAngle := segmentAngle - rotationAngle
+			srcDistance := distance / zoom
+			srcX := cx + srcDistance*math.Cos(srcAngle)
+			srcY := cy + srcDistance*math.Sin(srcAngle)
+
+			// Sample with edge clamping so no pixels are left unset
+			dst.Set(x, y, sample(src, srcX, srcY))
+		}
+	}
+}
+
+// sampleFunc returns the color at fractional coordinates (x, y) in src, where
+// pixel centers are at whole coordinates. Coordinates outside the image are
+// clamped to the nearest edge pixel.
+type sampleFunc func(src image.Image, x, y float64) color.RGBA
+
+// edgeSampler returns sample with coordinates outside the image handled by
+// the named edge mode instead of being clamped to the nearest edge pixel:
+// "wrap" tiles the image, "reflect" mirrors it at each edge and
+// "transparent" returns transparent black. "clamp", or any other name,
+// returns sample unchanged.
+func edgeSampler(sample sampleFunc, mode string) sampleFunc {
+	// Map a coordinate into the range covered by the image's pixels, from
+	// half a pixel before the first center to half a pixel after the last
+	var fold func(v float64, lo, n int) float64
+	switch mode {
+	case "wrap":
+		fold = func(v float64, lo, n int) float64 {
+			t := math.Mod(v-float64(lo)+0.5, float64(n))
+			if t < 0 {
+				t += float64(n)
+			}
+			return float64(lo) + t - 0.5
+		}
+	case "reflect":
+		fold = func(v float64, lo, n int) float64 {
+			t := math.Mod(v-float64(lo)+0.5, 2*float64(n))
+			if t < 0 {
+				t += 2 * float64(n)
+			}
+			if t > float64(n) {
+				t = 2*float64(n) - t
+			}
+			return float64(lo) + t - 0.5
+		}
+	case "transparent":
+		return func(src image.Image, x, y float64) color.RGBA {
+			bounds := src.Bounds()
+			if x < float64(bounds.Min.X)-0.5 || x > float64(bounds.Max.X)-0.5 || y < float64(bounds.Min.Y)-0.5 || y > float64(bounds.Max.Y)-0.5 {
+				return color.RGBA{}
+			}
+			return sample(src, x, y)
+		}
+	default:
+		return sample
+	}
+	return func(src image.Image, x, y float64) color.RGBA {
+		bounds := src.Bounds()
+		return sample(src, fold(x, bounds.Min.X, bounds.Dx()), fold(y, bounds.Min.Y, bounds.Dy()))
+	}
+}
+
+// sampleNearest returns the color of the pixel containing fractional
+// coordinates (x, y) in src, truncating them to whole pixels as the effects
+// always have for nearest-neighbor sampling. Coordinates outside the image
+// are clamped to the nearest edge pixel.
+func sampleNearest(src image.Image, x, y float64) color.RGBA {
+	bounds := src.Bounds()
+	sx := max(bounds.Min.X, min(bounds.Max.X-1, int(math.Floor(x))))
+	sy := max(bounds.Min.Y, min(bounds.Max.Y-1, int(math.Floor(y))))
+	return color.RGBAModel.Convert(src.At(sx, sy)).(color.RGBA)
+}
+
+// sampleBilinear returns the color at fractional coordinates (x, y) in src,
+// interpolated between the four surrounding pixels. Coordinates outside the
+// image are clamped to the nearest edge pixel.
+func sampleBilinear(src image.Image, x, y float64) color.RGBA {
+	bounds := src.Bounds()
+
+	// Clamp to the range covered by pixel coordinates
+	x = math.Max(float64(bounds.Min.X), math.Min(float64(bounds.Max.X-1), x))
+	y = math.Max(float64(bounds.Min.Y), math.Min(float64(bounds.Max.Y-1), y))
+
+	x0 := int(math.Floor(x))
+	y0 := int(math.Floor(y))
+	x1 := min(x0+1, bounds.Max.X-1)
+	y1 := min(y0+1, bounds.Max.Y-1)
+	fx := x - float64(x0)
+	fy := y - float64(y0)
+
+	r00, g00, b00, a00 := src.At(x0, y0).RGBA()
+	r10, g10, b10, a10 := src.At(x1, y0).RGBA()
+	r01, g01, b01, a01 := src.At(x0, y1).RGBA()
+	r11, g11, b11, a11 := src.At(x1, y1).RGBA()
+
+	// Interpolate horizontally then vertically, converting 16-bit to 8-bit
+	lerp := func(c00, c10, c01, c11 uint32) uint8 {
+		top := float64(c00)*(1-fx) + float64(c10)*fx
+		bottom := float64(c01)*(1-fx) + float64(c11)*fx
+		return uint8(math.Round((top*(1-fy) + bottom*fy) / 257.0))
+	}
+
+	return color.RGBA{
+		lerp(r00, r10, r01, r11),
+		lerp(g00, g10, g01, g11),
+		lerp(b00, b10, b01, b11),
+		lerp(a00, a10, a01, a11),
+	}
+}
+
+// applyRipple displaces pixels toward and away from the center with circular
+// waves. scale is the number of image pixels per output pixel, which the
+// wave's size is measured in.
+func applyRipple(dst *image.RGBA, src image.Image, cx, cy, phase, maxDistance, scale float64, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Ripple parameters
+	amplitude := 5.0 * scale // Maximum pixel displacement
+	frequency := 0.1 / scale // Ripple frequency
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Calculate distance from center
+			dx := float64(x) - cx
+			dy := float64(y) - cy
+			distance := math.Sqrt(dx*dx + dy*dy)
+
+			// Calculate ripple displacement
+			ripple := amplitude * math.Sin(distance*frequency-phase)
+
+			// Calculate angle
+			angle := math.Atan2(dy, dx)
+
+			// Apply displacement along the radial direction
+			displacedDistance := distance + ripple
+			srcX := cx + displacedDistance*math.Cos(angle)
+			srcY := cy + displacedDistance*math.Sin(angle)
+
+			// Sample with edge clamping, so out of bounds points use the
+			// nearest edge pixel
+			dst.Set(x, y, sample(src, srcX, srcY))
+		}
+	}
+}
+
+// ParseDisposal converts a disposal method name to its GIF disposal value.
+// An empty name returns 0 (unspecified).
+func ParseDisposal(name string) (byte, error) {
+	switch name {
+	case "":
+		return 0, nil
+	case "none":
+		return gif.DisposalNone, nil
+	case "background":
+		return gif.DisposalBackground, nil
+	case "previous":
+		return gif.DisposalPrevious, nil
+	default:
+		return 0, fmt.Errorf("unknown disposal method: %s (expected none, background or previous)", name)
+	}
+}
+
+// HasTransparency reports whether the palette contains a fully transparent color.
+func HasTransparency(palette color.Palette) bool {
+	for _, c := range palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// reserveTransparent returns a palette containing a fully transparent color,
+// along with its index. An existing transparent entry is reused; otherwise one
+// is appended, dropping the last color if the palette is already full.
+func reserveTransparent(palette color.Palette) (color.Palette, uint8) {
+	for i, c := range palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return palette, uint8(i)
+		}
+	}
+
+	if len(palette) >= 256 {
+		palette = palette[:255]
+	}
+	result := make(color.Palette, len(palette), len(palette)+1)
+	copy(result, palette)
+	result = append(result, color.RGBA{})
+	return result, uint8(len(result) - 1)
+}
+
+// optimizeFrame returns the smallest rectangle of cur containing the pixels
+// that differ from prev. Unchanged pixels within that rectangle are set to
+// the transparent index so the previous frame shows through. Frames are
+// compared after palette conversion, so only differences that are actually
+// visible are encoded. The frames must share a palette and be displayed with
+// DisposalNone, and no pixel may go from opaque in prev to transparent in
+// cur (see uncovers), as the previous frame would show through.
+func optimizeFrame(prev, cur *image.Paletted, transparentIndex uint8) *image.Paletted {
+	bounds := cur.Bounds()
+
+	// Find the bounding box of changed pixels
+	dirty := image.Rectangle{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if cur.ColorIndexAt(x, y) != prev.ColorIndexAt(x, y) {
+				dirty = dirty.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	// GIF frames can't be empty, so emit a single transparent pixel
+	if dirty.Empty() {
+		frame := image.NewPaletted(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+1, bounds.Min.Y+1), cur.Palette)
+		frame.SetColorIndex(bounds.Min.X, bounds.Min.Y, transparentIndex)
+		return frame
+	}
+
+	// Copy changed pixels, leaving unchanged ones transparent
+	frame := image.NewPaletted(dirty, cur.Palette)
+	for y := dirty.Min.Y; y < dirty.Max.Y; y++ {
+		for x := dirty.Min.X; x < dirty.Max.X; x++ {
+			idx := cur.ColorIndexAt(x, y)
+			if idx == prev.ColorIndexAt(x, y) {
+				idx = transparentIndex
+			}
+			frame.SetColorIndex(x, y, idx)
+		}
+	}
+
+	return frame
+}
+
+// applyPinch squeezes the image toward the center. Each pixel samples the
+// source farther out along the same radius, with the displacement largest
+// near the center and falling to zero at maxDistance. A strength of 0 leaves
+// the image unchanged.
+func applyPinch(dst *image.RGBA, src image.Image, cx, cy, maxDistance, strength float64, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Radii are remapped as r^exponent on a 0-1 scale, pulling content inward
+	exponent := 1.0 / (1.0 + strength)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Calculate distance from center
+			dx := float64(x) - cx
+			dy := float64(y) - cy
+			distance := math.Sqrt(dx*dx + dy*dy)
+			if distance == 0 || distance >= maxDistance {
+				dst.Set(x, y, src.At(x, y))
+				continue
+			}
+
+			// Sample the source at the remapped radius
+			srcDistance := maxDistance * math.Pow(distance/maxDistance, exponent)
+			scale := srcDistance / distance
+			dst.Set(x, y, sample(src, cx+dx*scale, cy+dy*scale))
+		}
+	}
+}
+
+// applyGlow adds a neon halo around the bright regions of the image. Pixels
+// brighter than a luminance threshold form a mask, which is blurred to spread
+// it past the edges of those regions, tinted with the given hue and added on
+// top of the source.
+func applyGlow(dst *image.RGBA, src image.Image, hue float64, radius int, intensity float64) {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Glow strength ramps up from the threshold to full white
+	threshold := 0.6
+
+	// Build the mask of bright pixels
+	mask := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, a := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			if a == 0 {
+				continue
+			}
+			// Luminance of the unpremultiplied color (Rec. 601 weights)
+			lum := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / float64(a)
+			mask[y*width+x] = math.Max(0, (lum-threshold)/(1.0-threshold)) * float64(a) / 0xffff
+		}
+	}
+
+	// Two box blur passes approximate a smooth, roughly Gaussian falloff
+	tmp := make([]float64, width*height)
+	for pass := 0; pass < 2; pass++ {
+		boxBlur(tmp, mask, width, height, radius, 1, width)
+		boxBlur(mask, tmp, height, width, radius, width, 1)
+	}
+
+	// Add the tinted halo over the source
+	tintR, tintG, tintB := hsvToRGB(hue, 1.0, 1.0)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, a := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			glow := math.Min(1.0, mask[y*width+x]*intensity)
+
+			// Colors are premultiplied, so the halo also fills in alpha
+			// where it spreads over transparent areas
+			dst.SetRGBA(bounds.Min.X+x, bounds.Min.Y+y, color.RGBA{
+				R: clamp8(float64(r>>8) + float64(tintR)*glow),
+				G: clamp8(float64(g>>8) + float64(tintG)*glow),
+				B: clamp8(float64(b>>8) + float64(tintB)*glow),
+				A: clamp8(float64(a>>8) + (255-float64(a>>8))*glow),
+			})
+		}
+	}
+}
+
+// applyOutline draws a stroke of the given color and width around the
+// opaque parts of the image, beneath the image itself, like the border of a
+// sticker. The stroke covers everything within width pixels of a pixel of
+// the image, weighted by that pixel's alpha, with an antialiased outer edge.
+// Fully opaque images have nowhere to draw it and are unchanged.
+func applyOutline(dst *image.RGBA, src image.Image, stroke color.RGBA, width int) {
+	bounds := dst.Bounds()
+	w := bounds.Dx()
+	h := bounds.Dy()
+
+	alpha := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			_, _, _, a := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			alpha[y*w+x] = float64(a) / 0xffff
+		}
+	}
+
+	// Dilate the alpha mask with a disc, fading out over its last pixel
+	type tap struct {
+		dx, dy int
+		weight float64
+	}
+	var disc []tap
+	for dy := -width - 1; dy <= width+1; dy++ {
+		for dx := -width - 1; dx <= width+1; dx++ {
+			weight := math.Min(1, float64(width)+0.5-math.Hypot(float64(dx), float64(dy)))
+			if weight > 0 {
+				disc = append(disc, tap{dx, dy, weight})
+			}
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBAModel.Convert(src.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			if c.A == 255 {
+				dst.SetRGBA(bounds.Min.X+x, bounds.Min.Y+y, c)
+				continue
+			}
+
+			coverage := 0.0
+			for _, t := range disc {
+				sx, sy := x+t.dx, y+t.dy
+				if sx < 0 || sx >= w || sy < 0 || sy >= h {
+					continue
+				}
+				coverage = math.Max(coverage, alpha[sy*w+sx]*t.weight)
+			}
+
+			// Composite the image over the stroke (colors are premultiplied)
+			under := coverage * float64(255-c.A) / 255
+			over := func(v, s uint8) uint8 {
+				return clamp8(float64(v) + float64(s)*under + 0.5)
+			}
+			dst.SetRGBA(bounds.Min.X+x, bounds.Min.Y+y, color.RGBA{over(c.R, stroke.R), over(c.G, stroke.G), over(c.B, stroke.B), over(c.A, stroke.A)})
+		}
+	}
+}
+
+// applyHeat shimmers the image like hot air rising off asphalt. Each column
+// is displaced vertically by a sine wave across the image, scaled from no
+// displacement at the top to amplitude pixels at the bottom. The wave is
+// stretched by scale, the number of image pixels per output pixel.
+func applyHeat(dst *image.RGBA, src image.Image, phase, amplitude, scale float64, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	frequency := 0.15 / scale // Wave frequency across the image, in radians per pixel
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Displacement grows toward the bottom of the image
+			offset := amplitude * (float64(y) / float64(height)) * math.Sin(float64(x)*frequency+phase)
+
+			// Sample with edge clamping
+			dst.Set(bounds.Min.X+x, bounds.Min.Y+y, sample(src, float64(bounds.Min.X+x), float64(bounds.Min.Y+y)+offset))
+		}
+	}
+}
+
+// applyKenBurns fills dst with a window of the source magnified by zoom and
+// centered on the point (anchorX, anchorY), given as fractions of the source
+// size. The window is moved as needed to stay inside the source, so anchors
+// near the edges pan right up to the edge without showing past it.
+func applyKenBurns(dst *image.RGBA, src image.Image, zoom, anchorX, anchorY float64, sample sampleFunc) {
+	dstBounds := dst.Bounds()
+	dstWidth := float64(dstBounds.Dx())
+	dstHeight := float64(dstBounds.Dy())
+
+	srcBounds := src.Bounds()
+	srcWidth := float64(srcBounds.Dx())
+	srcHeight := float64(srcBounds.Dy())
+
+	// Calculate the source region to sample from, clamped inside the source
+	srcRegionWidth := srcWidth / zoom
+	srcRegionHeight := srcHeight / zoom
+	srcMinX := math.Max(0, math.Min(srcWidth-srcRegionWidth, anchorX*srcWidth-srcRegionWidth/2.0))
+	srcMinY := math.Max(0, math.Min(srcHeight-srcRegionHeight, anchorY*srcHeight-srcRegionHeight/2.0))
+
+	// For each pixel in destination, find corresponding point in source
+	for y := 0; y < dstBounds.Dy(); y++ {
+		for x := 0; x < dstBounds.Dx(); x++ {
+			// Map the destination pixel center to source coordinates
+			srcX := srcMinX + ((float64(x)+0.5)/dstWidth)*srcRegionWidth - 0.5
+			srcY := srcMinY + ((float64(y)+0.5)/dstHeight)*srcRegionHeight - 0.5
+
+			// Sample between pixels so the slow pan moves smoothly with
+			// bilinear sampling
+			dst.Set(x+dstBounds.Min.X, y+dstBounds.Min.Y,
+				sample(src, srcX+float64(srcBounds.Min.X), srcY+float64(srcBounds.Min.Y)))
+		}
+	}
+}
+
+// applyReflect keeps the top half of the image and replaces the bottom half
+// with its mirror image, as if reflected in water. The reflection is displaced
+// sideways by waves that grow stronger farther from the waterline, up to
+// amplitude pixels, and travel with the phase. The waves are stretched by
+// scale, the number of image pixels per output pixel.
+func applyReflect(dst *image.RGBA, src image.Image, phase, amplitude, scale float64, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	horizon := height / 2
+	frequency := 0.3 / scale // Ripple frequency, in radians per pixel below the waterline
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Copy the top half unchanged
+			if y < horizon {
+				dst.Set(bounds.Min.X+x, bounds.Min.Y+y, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+				continue
+			}
+
+			// Mirror about the waterline, with ripples damped near it
+			depth := float64(y - horizon)
+			damping := 0.5 + 0.5*depth/float64(height-horizon)
+			offset := amplitude * damping * math.Sin(depth*frequency-phase)
+			srcY := float64(horizon - 1 - (y - horizon))
+
+			// Sample with edge clamping
+			dst.Set(bounds.Min.X+x, bounds.Min.Y+y, sample(src, float64(bounds.Min.X+x)+offset, float64(bounds.Min.Y)+srcY))
+		}
+	}
+}
+
+// applyGradientMap replaces the color of each pixel with the color at its
+// luminance along the gradient through stops, evenly spaced from black to
+// white, keeping the pixel's alpha. The shift is added to the luminance
+// first, with positions past the end of the gradient reflected back, so a
+// shift of 2 returns to the unshifted mapping.
+func applyGradientMap(dst *image.RGBA, src image.Image, stops []color.RGBA, shift float64) {
+	bounds := src.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+
+			// Luminance of the unpremultiplied color (Rec. 601 weights)
+			lum := (0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)) / 255.0
+
+			// Reflect the shifted position back into the 0-1 range
+			t := math.Mod(lum+shift, 2.0)
+			if t > 1.0 {
+				t = 2.0 - t
+			}
+
+			// Interpolate between the two stops around the position
+			pos := t * float64(len(stops)-1)
+			i := min(int(pos), len(stops)-2)
+			frac := pos - float64(i)
+			lerp := func(a, b uint8) uint8 {
+				return clamp8(float64(a)*(1.0-frac) + float64(b)*frac + 0.5)
+			}
+			from, to := stops[i], stops[i+1]
+			dst.Set(x, y, color.NRGBA{lerp(from.R, to.R), lerp(from.G, to.G), lerp(from.B, to.B), c.A})
+		}
+	}
+}
+
+// bounceCurve returns the height of a bouncing drop at time t (0 to 1), as a
+// fraction of the starting height, and how hard it is hitting the ground (0
+// in the air, up to 1 on the first impact). The drop falls, hits the ground
+// and makes three smaller bounces before coming to rest.
+func bounceCurve(t float64) (height, impact float64) {
+	// How long the squash lasts after each landing
+	squashTime := 0.08
+
+	// Fall and bounce durations, each bounce much lower than the last
+	segments := []struct{ start, end, peak float64 }{
+		{-0.35, 0.35, 1.0},
+		{0.35, 0.6, 0.25},
+		{0.6, 0.75, 0.08},
+		{0.75, 0.83, 0.02},
+	}
+	for i, seg := range segments {
+		if t >= seg.end {
+			continue
+		}
+		// Parabolic arc between touching the ground at start and end
+		mid := (seg.start + seg.end) / 2.0
+		half := (seg.end - seg.start) / 2.0
+		u := (t - mid) / half
+		height = seg.peak * (1.0 - u*u)
+
+		// Squash just after landing, weaker for each bounce
+		sinceLanding := t - seg.start
+		if i > 0 && sinceLanding < squashTime {
+			impact = segments[i-1].peak * (1.0 - sinceLanding/squashTime)
+		}
+		return height, impact
+	}
+
+	// At rest, squashing briefly after the last landing
+	last := segments[len(segments)-1]
+	if sinceLanding := t - last.end; sinceLanding < squashTime {
+		impact = last.peak * (1.0 - sinceLanding/squashTime)
+	}
+	return 0, impact
+}
+
+// applyBounce draws the image moved down by offsetY pixels (negative moves it
+// up) and squashed by the given fraction: shorter by squash and wider by the
+// same fraction, anchored at its bottom center. Uncovered areas are left
+// transparent.
+func applyBounce(dst *image.RGBA, src image.Image, offsetY int, squash float64, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := float64(bounds.Dx())
+	height := float64(bounds.Dy())
+
+	// The image's bottom edge and horizontal center after moving
+	bottom := height + float64(offsetY)
+	centerX := width / 2.0
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			// Map back through the squash to the source pixel
+			srcX := centerX + (float64(x)+0.5-centerX)/(1.0+squash)
+			srcY := height - (bottom-float64(y)-0.5)/(1.0-squash)
+			if srcX < 0 || srcX >= width || srcY < 0 || srcY >= height {
+				continue
+			}
+
+			dst.Set(bounds.Min.X+x, bounds.Min.Y+y, sample(src, float64(bounds.Min.X)+srcX-0.5, float64(bounds.Min.Y)+srcY-0.5))
+		}
+	}
+}
+
+// jellyGrid is the number of mesh cells across and down that jelly deforms.
+const jellyGrid = 4
+
+// jellyAmplitude is how far the top of the jelly moves at the start of the
+// wobble, as a fraction of the image size.
+const jellyAmplitude = 0.15
+
+// applyJelly wobbles the image like jelly on a plate at time t (0 to 1): it
+// starts squashed, then springs back and forth between squashed and
+// stretched, making stiffness wobbles over the loop that die down as
+// exp(-damping*t), shifted and rescaled to come to rest at the end of the
+// loop so that it restarts from still jelly. Squashing bulges the sides out, and the top lags behind
+// the bottom, which stays put. The deformation is set at the points of a
+// coarse mesh and interpolated bilinearly in between; each pixel samples the
+// source back along the displacement at its position, which stands in for
+// the inverse of the warp since the displacements are small and smooth.
+func applyJelly(dst *image.RGBA, src image.Image, t, stiffness, damping float64, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := float64(bounds.Dx())
+	height := float64(bounds.Dy())
+
+	// Displace the mesh points, more the higher they are above the bottom
+	var meshX, meshY [jellyGrid + 1][jellyGrid + 1]float64
+	decay := 1.0
+	if damping > 0 {
+		rest := math.Exp(-damping)
+		decay = (math.Exp(-damping*t) - rest) / (1 - rest)
+	}
+	for j := 0; j <= jellyGrid; j++ {
+		above := 1.0 - float64(j)/jellyGrid
+		wobble := decay * math.Cos(2.0*math.Pi*stiffness*(t-0.05*above))
+		sway := decay * math.Sin(2.0*math.Pi*stiffness*t)
+		for i := 0; i <= jellyGrid; i++ {
+			across := float64(i)/jellyGrid - 0.5
+			meshX[j][i] = jellyAmplitude * width * above * (across*wobble + 0.3*above*sway)
+			meshY[j][i] = jellyAmplitude * height * above * wobble
+		}
+	}
+
+	for y := 0; y < bounds.Dy(); y++ {
+		// Find the mesh cell and the position within it
+		gy := (float64(y) + 0.5) / height * jellyGrid
+		j := min(jellyGrid-1, int(gy))
+		fy := gy - float64(j)
+		for x := 0; x < bounds.Dx(); x++ {
+			gx := (float64(x) + 0.5) / width * jellyGrid
+			i := min(jellyGrid-1, int(gx))
+			fx := gx - float64(i)
+
+			lerp := func(mesh *[jellyGrid + 1][jellyGrid + 1]float64) float64 {
+				top := mesh[j][i]*(1-fx) + mesh[j][i+1]*fx
+				bottom := mesh[j+1][i]*(1-fx) + mesh[j+1][i+1]*fx
+				return top*(1-fy) + bottom*fy
+			}
+			srcX := float64(bounds.Min.X+x) - lerp(&meshX)
+			srcY := float64(bounds.Min.Y+y) - lerp(&meshY)
+			dst.SetRGBA(bounds.Min.X+x, bounds.Min.Y+y, sample(src, srcX, srcY))
+		}
+	}
+}
+
+// applyRGBJitter samples the red, green and blue channels of each pixel from
+// the source offset by rOff, gOff and bOff respectively, clamping to the
+// nearest edge pixel. Alpha is kept from the unshifted pixel.
+func applyRGBJitter(dst *image.RGBA, src image.Image, rOff, gOff, bOff image.Point) {
+	bounds := dst.Bounds()
+
+	// Sample one channel at an offset, with edge clamping
+	sample := func(x, y int, off image.Point) (r, g, b uint32) {
+		sx := max(bounds.Min.X, min(bounds.Max.X-1, x+off.X))
+		sy := max(bounds.Min.Y, min(bounds.Max.Y-1, y+off.Y))
+		r, g, b, _ = src.At(sx, sy).RGBA()
+		return r, g, b
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, _, _ := sample(x, y, rOff)
+			_, g, _ := sample(x, y, gOff)
+			_, _, b := sample(x, y, bOff)
+			_, _, _, a := src.At(x, y).RGBA()
+
+			// Keep the premultiplied channels within alpha
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(min(r, a) >> 8),
+				G: uint8(min(g, a) >> 8),
+				B: uint8(min(b, a) >> 8),
+				A: uint8(a >> 8),
+			})
+		}
+	}
+}
+
+// applyCMYKShift separates src into cyan, magenta, yellow and black plates
+// and recombines them with each plate sampled from the source offset by the
+// matching entry of offsets (in C, M, Y, K order), clamping to the nearest
+// edge pixel, like a print with misaligned plates. Alpha is kept from the
+// unshifted pixel.
+func applyCMYKShift(dst *image.RGBA, src image.Image, offsets [4]image.Point) {
+	bounds := dst.Bounds()
+
+	// Separate the pixel at an offset into plates, with edge clamping. Work
+	// on unpremultiplied colors so that transparent areas don't turn black
+	plates := func(x, y int, off image.Point) color.CMYK {
+		sx := max(bounds.Min.X, min(bounds.Max.X-1, x+off.X))
+		sy := max(bounds.Min.Y, min(bounds.Max.Y-1, y+off.Y))
+		c := color.NRGBAModel.Convert(src.At(sx, sy)).(color.NRGBA)
+		return color.CMYKModel.Convert(color.RGBA{c.R, c.G, c.B, 255}).(color.CMYK)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b := color.CMYKToRGB(
+				plates(x, y, offsets[0]).C,
+				plates(x, y, offsets[1]).M,
+				plates(x, y, offsets[2]).Y,
+				plates(x, y, offsets[3]).K,
+			)
+			_, _, _, a := src.At(x, y).RGBA()
+
+			// Premultiply by the unshifted alpha
+			alpha := float64(a>>8) / 255.0
+			dst.SetRGBA(x, y, color.RGBA{
+				R: clamp8(float64(r)*alpha + 0.5),
+				G: clamp8(float64(g)*alpha + 0.5),
+				B: clamp8(float64(b)*alpha + 0.5),
+				A: uint8(a >> 8),
+			})
+		}
+	}
+}
+
+// applyTile fills dst with tilesX by tilesY shrunken copies of src, shifted
+// right and down by the offset with wraparound. Each output pixel averages
+// the block of source pixels it was shrunk from.
+func applyTile(dst *image.RGBA, src image.Image, tilesX, tilesY, offsetX, offsetY int) {
+	bounds := src.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+	count := uint32(tilesX * tilesY)
+
+	for y := range height {
+		// Position within the repeating pattern, wrapped into the image
+		ty := ((y-offsetY)%height + height) % height
+		for x := range width {
+			tx := ((x-offsetX)%width + width) % width
+			var r, g, b, a uint32
+			for j := range tilesY {
+				sy := (ty*tilesY + j) % height
+				for i := range tilesX {
+					sx := (tx*tilesX + i) % width
+					c := src.At(bounds.Min.X+sx, bounds.Min.Y+sy)
+					cr, cg, cb, ca := c.RGBA()
+					r += cr >> 8
+					g += cg >> 8
+					b += cb >> 8
+					a += ca >> 8
+				}
+			}
+			dst.SetRGBA(dst.Rect.Min.X+x, dst.Rect.Min.Y+y, color.RGBA{
+				R: uint8(r / count),
+				G: uint8(g / count),
+				B: uint8(b / count),
+				A: uint8(a / count),
+			})
+		}
+	}
+}
+
+// applyGrow draws src scaled by scale (0 to 1) in the center of dst, leaving
+// the rest transparent. Each output pixel averages the area of the source
+// it covers, so the shrunken image stays smooth and its edges antialiased.
+func applyGrow(dst *image.RGBA, src image.Image, scale float64) {
+	bounds := src.Bounds()
+	width := float64(bounds.Dx())
+	height := float64(bounds.Dy())
+	if scale <= 0 {
+		return
+	}
+
+	// Top-left corner of the scaled image within dst
+	offsetX := (width - width*scale) / 2
+	offsetY := (height - height*scale) / 2
+
+	// overlaps returns the first and last source pixels the span from lo to
+	// hi covers, and how much of pixel i lies within it
+	overlaps := func(lo, hi, size float64) (int, int, func(i int) float64) {
+		lo = math.Max(0, lo)
+		hi = math.Min(size, hi)
+		return int(math.Floor(lo)), int(math.Ceil(hi)) - 1, func(i int) float64 {
+			return math.Min(hi, float64(i+1)) - math.Max(lo, float64(i))
+		}
+	}
+
+	area := 1 / (scale * scale)
+	for y := range bounds.Dy() {
+		y0, y1, coverY := overlaps((float64(y)-offsetY)/scale, (float64(y+1)-offsetY)/scale, height)
+		if y1 < y0 {
+			continue
+		}
+		for x := range bounds.Dx() {
+			x0, x1, coverX := overlaps((float64(x)-offsetX)/scale, (float64(x+1)-offsetX)/scale, width)
+			if x1 < x0 {
+				continue
+			}
+
+			// Divide by the whole area the pixel covers, so pixels on the
+			// image's edge are partially transparent
+			var r, g, b, a float64
+			for sy := y0; sy <= y1; sy++ {
+				for sx := x0; sx <= x1; sx++ {
+					weight := coverX(sx) * coverY(sy)
+					cr, cg, cb, ca := src.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r += float64(cr>>8) * weight
+					g += float64(cg>>8) * weight
+					b += float64(cb>>8) * weight
+					a += float64(ca>>8) * weight
+				}
+			}
+			dst.SetRGBA(dst.Rect.Min.X+x, dst.Rect.Min.Y+y, color.RGBA{
+				R: clamp8(r/area + 0.5),
+				G: clamp8(g/area + 0.5),
+				B: clamp8(b/area + 0.5),
+				A: clamp8(a/area + 0.5),
+			})
+		}
+	}
+}
+
+// applyMirrorTile fills the top-left quarter of dst with the quarter-sized
+// slice of src starting at the offset (wrapping around its edges), and
+// mirrors it across the vertical and horizontal center lines so the four
+// quarters form a symmetric tile.
+func applyMirrorTile(dst *image.RGBA, src image.Image, offsetX, offsetY int) {
+	bounds := src.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	for y := range height {
+		// Fold the bottom half up onto the top half
+		my := y
+		if y >= (height+1)/2 {
+			my = height - 1 - y
+		}
+		sy := ((my+offsetY)%height + height) % height
+		for x := range width {
+			mx := x
+			if x >= (width+1)/2 {
+				mx = width - 1 - x
+			}
+			sx := ((mx+offsetX)%width + width) % width
+			dst.Set(dst.Rect.Min.X+x, dst.Rect.Min.Y+y, src.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+}
+
+// boxBlur averages each value in src over a window of 2*radius+1 values along
+// one axis and writes the result to dst. The data is treated as lines of
+// length values, stride apart, with consecutive lines step apart; values
+// beyond the ends of a line count as zero so the blur fades out at the edges.
+func boxBlur(dst, src []float64, lines, length, radius, step, stride int) {
+	window := float64(2*radius + 1)
+	for line := 0; line < lines; line++ {
+		start := line * step
+		sum := 0.0
+		for i := 0; i < min(radius, length); i++ {
+			sum += src[start+i*stride]
+		}
+		for i := 0; i < length; i++ {
+			if i+radius < length {
+				sum += src[start+(i+radius)*stride]
+			}
+			if i-radius-1 >= 0 {
+				sum -= src[start+(i-radius-1)*stride]
+			}
+			dst[start+i*stride] = sum / window
+		}
+	}
+}
+
+// applyTwirl twists the image around (cx, cy). The twist angle is
+// maxTwist * progress at the center and falls off to zero at the given
+// radius, so increasing progress over the frames winds the image up.
+func applyTwirl(dst *image.RGBA, src image.Image, cx, cy, radius, maxTwist, progress float64, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+	twist := maxTwist * progress
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Calculate distance from center
+			dx := float64(x) - cx
+			dy := float64(y) - cy
+			distance := math.Sqrt(dx*dx + dy*dy)
+			if distance >= radius || twist == 0 {
+				dst.Set(x, y, src.At(x, y))
+				continue
+			}
+
+			// Rotate the sample point, more strongly toward the center
+			angle := math.Atan2(dy, dx) - twist*(1.0-distance/radius)
+			srcX := cx + distance*math.Cos(angle)
+			srcY := cy + distance*math.Sin(angle)
+
+			// Sample with edge clamping
+			dst.Set(x, y, sample(src, srcX, srcY))
+		}
+	}
+}
+
+// applyLinearRipple displaces pixels along a direction with plane waves
+// traveling at the given angle (in radians), like a flag or water surface.
+// As in applyRipple, the wave's size is measured in output pixels of scale
+// image pixels each.
+func applyLinearRipple(dst *image.RGBA, src image.Image, cx, cy, phase, angle, scale float64, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Ripple parameters (matching applyRipple)
+	amplitude := 5.0 * scale // Maximum pixel displacement
+	frequency := 0.1 / scale // Ripple frequency
+
+	// Unit vector for the direction of travel
+	dirX := math.Cos(angle)
+	dirY := math.Sin(angle)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Distance along the direction of travel
+			dx := float64(x) - cx
+			dy := float64(y) - cy
+			distance := dx*dirX + dy*dirY
+
+			// Calculate ripple displacement
+			ripple := amplitude * math.Sin(distance*frequency-phase)
+
+			// Apply displacement along the direction of travel
+			srcX := float64(x) + ripple*dirX
+			srcY := float64(y) + ripple*dirY
+
+			// Sample with edge clamping, using the nearest edge pixel
+			dst.Set(x, y, sample(src, srcX, srcY))
+		}
+	}
+}
+
+// ParseHexColor parses a color in #RGB, #RGBA, #RRGGBB or #RRGGBBAA form (the
+// leading # is optional), or a CSS color name such as "orange". Colors with
+// an alpha component are returned premultiplied, like all color.RGBA values.
+// Every color flag is parsed with it so they all accept the same forms.
+func ParseHexColor(s string) (color.RGBA, error) {
+	if c, ok := colornames.Map[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	switch len(hex) {
+	case 3, 4:
+		// Expand short forms to two digits per channel, so #f80 is #ff8800
+		var long strings.Builder
+		for _, digit := range hex {
+			long.WriteRune(digit)
+			long.WriteRune(digit)
+		}
+		hex = long.String()
+	case 6, 8:
+	default:
+		return color.RGBA{}, fmt.Errorf("invalid color '%s'", s)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color '%s'", s)
+	}
+
+	c := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(c).(color.RGBA), nil
+}
+
+// BuildPalette creates the palette for an animation of img. When morphing to
+// a second image, half of the colors are taken from each image so that both
+// ends of the dissolve are represented. A transparent color is included if
+// any of the effects uncover transparent areas, or if the image has any, such
+// as the padding added by -canvas, that sampling may have missed. Colors
+// that effects draw with, rather than take from the image, are included too,
+// and any colors left over are filled from a few of the generated frames so
+// that effects that create new colors, such as tint-rgb, keep them. If the
+// image has more colors than fit, a quarter of the palette is kept for the
+// generated frames, so that a many-colored image can't crowd those colors
+// out. A fixed opts.Palette is used as it is instead, apart from the
+// transparent color.
+func BuildPalette(img image.Image, effects []EffectSpec, opts Options) color.Palette {
+	opts = opts.withDefaults()
+	var palette color.Palette
+	if opts.Palette != nil {
+		palette = slices.Clone(opts.Palette)
+	} else {
+		drawn := effectColors(effects, opts)
+		drawn = drawn[:min(len(drawn), opts.Colors/2)]
+		colors := opts.Colors - len(drawn)
+
+		var truncated bool
+		palette, truncated = sourcePalette(img, opts.Image2, colors)
+		reserved := 0
+		if truncated && len(effects) > 0 {
+			reserved = colors / 4
+			palette, _ = sourcePalette(img, opts.Image2, colors-reserved)
+		}
+		palette = append(palette, drawn...)
+		palette = addFrameColors(palette, img, effects, opts, opts.Colors)
+
+		// Give any of the reserved colors the frames didn't need back to
+		// the image
+		if reserved > 0 && len(palette) < opts.Colors {
+			full, _ := sourcePalette(img, opts.Image2, colors)
+			palette = appendNewColors(palette, full, opts.Colors)
+		}
+	}
+
+	uncovers := func(e EffectSpec) bool {
+		return transparentEffects[e.Name] || e.Name == "ripple" && opts.RippleEdge == "transparent"
+	}
+	if slices.ContainsFunc(effects, uncovers) || !isOpaque(img) {
+		palette, _ = reserveTransparent(palette)
+	}
+	return palette
+}
+
+// sourcePalette samples up to maxColors colors from img, or half from each
+// image when morphing to img2, and reports whether either image had more
+// colors than fit.
+func sourcePalette(img, img2 image.Image, maxColors int) (color.Palette, bool) {
+	if img2 == nil {
+		return SamplePalette(img, maxColors)
+	}
+	palette, truncated := SamplePalette(img, maxColors/2)
+	palette2, truncated2 := SamplePalette(img2, maxColors-len(palette))
+	return append(palette, palette2...), truncated || truncated2
+}
+
+// appendNewColors appends the colors of extra that palette doesn't already
+// have, until it has maxColors colors.
+func appendNewColors(palette, extra color.Palette, maxColors int) color.Palette {
+	seen := make(map[color.RGBA]bool, maxColors)
+	for _, c := range palette {
+		seen[color.RGBAModel.Convert(c).(color.RGBA)] = true
+	}
+	for _, c := range extra {
+		if len(palette) >= maxColors {
+			break
+		}
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		if !seen[rgba] {
+			seen[rgba] = true
+			palette = append(palette, c)
+		}
+	}
+	return palette
+}
+
+// effectColors returns the colors the effects draw with that needn't appear
+// in the image: the outline stroke, or a wheel of hues if it cycles.
+func effectColors(effects []EffectSpec, opts Options) color.Palette {
+	if !slices.ContainsFunc(effects, func(e EffectSpec) bool { return e.Name == "outline" }) {
+		return nil
+	}
+	if !opts.OutlineCycle {
+		return color.Palette{opts.OutlineColor}
+	}
+	var colors color.Palette
+	for hue := 0.0; hue < 360.0; hue += 30.0 {
+		r, g, b := hsvToRGB(hue, 1.0, 1.0)
+		colors = append(colors, color.RGBA{r, g, b, 255})
+	}
+	return colors
+}
+
+// paletteFrames is how many frames, spread through the loop, addFrameColors
+// samples.
+const paletteFrames = 4
+
+// addFrameColors appends colors found in a few rendered frames of the
+// animation that palette doesn't already have, until it has maxColors
+// colors. If the frames have more new colors than fit, they are picked
+// evenly from all of the sampled frames rather than the first ones found,
+// so that every part of the loop is represented. Frames are sampled as they
+// will be converted, after alpha thresholding; transparent pixels are
+// skipped, since BuildPalette decides whether to reserve a transparent
+// color. If a frame can't be rendered, the palette is returned as it is and
+// the error is left for the render itself.
+func addFrameColors(palette color.Palette, img image.Image, effects []EffectSpec, opts Options, maxColors int) color.Palette {
+	if len(effects) == 0 || len(palette) >= maxColors {
+		return palette
+	}
+
+	seen := make(map[color.RGBA]bool, maxColors)
+	for _, c := range palette {
+		seen[color.RGBAModel.Convert(c).(color.RGBA)] = true
+	}
+
+	// Render at the output resolution without reporting the stages, since
+	// these frames are only looked at
+	opts.OnStage = nil
+	count := min(paletteFrames, opts.Frames)
+	var found []color.RGBA
+	for i := 0; i < count; i++ {
+		frame, _, err := renderFrame(img, effects, i*opts.Frames/count, opts.Frames, opts, nil)
+		if err != nil {
+			return palette
+		}
+		frame = thresholdAlpha(frame, opts.AlphaThreshold)
+
+		// Sample every 4th pixel, as SamplePalette does
+		bounds := frame.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y += 4 {
+			for x := bounds.Min.X; x < bounds.Max.X; x += 4 {
+				c := frame.RGBAAt(x, y)
+				if c.A == 0 || seen[c] {
+					continue
+				}
+				seen[c] = true
+				found = append(found, c)
+			}
+		}
+	}
+
+	n := min(maxColors-len(palette), len(found))
+	for i := range n {
+		palette = append(palette, found[i*len(found)/n])
+	}
+	return palette
+}
+
+// isOpaque reports whether every pixel of img is fully opaque.
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// transparentEffects are the effects that can leave parts of the frame
+// transparent, even for an opaque image.
+var transparentEffects = map[string]bool{
+	"bounce": true,
+	"grow":   true,
+	"jelly":  true,
+}
+
+// SamplePalette builds a palette of at most maxColors colors from the image,
+// and reports whether the sampled pixels had more distinct colors than fit.
+func SamplePalette(img image.Image, maxColors int) (palette color.Palette, truncated bool) {
+	// Sample colors from the image to create a palette
+	// Use a simple approach: sample every Nth pixel
+	bounds := img.Bounds()
+	paletteMap := make(map[color.Color]bool)
+	palette = make(color.Palette, 0, maxColors)
+
+	// Sample pixels, stopping at the first new color that doesn't fit
+	step := 4
+	for y := bounds.Min.Y; y < bounds.Max.Y && !truncated; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			c := img.At(x, y)
+			if paletteMap[c] {
+				continue
+			}
+			if len(palette) >= maxColors {
+				truncated = true
+				break
+			}
+			paletteMap[c] = true
+			palette = append(palette, c)
+		}
+	}
+
+	// Ensure we have at least some colors
+	if len(palette) == 0 {
+		palette = append(palette, color.White, color.Black)
+	}
+
+	return palette, truncated
+}
+
+func drawRotatedImage(dst *image.RGBA, src image.Image, cx, cy, angle float64, sample sampleFunc) {
+	bounds := dst.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Precompute sin and cos
+	cos := math.Cos(angle)
+	sin := math.Sin(angle)
+
+	srcBounds := src.Bounds()
+	srcWidth := float64(srcBounds.Dx())
+	srcHeight := float64(srcBounds.Dy())
+
+	// For each pixel in destination, find corresponding pixel in source
+	for y := range height {
+		for x := range width {
+			// Translate to center
+			dx := float64(x) - cx
+			dy := float64(y) - cy
+
+			// Rotate backwards (inverse rotation)
+			sx := dx*cos + dy*sin
+			sy := -dx*sin + dy*cos
+
+			// Translate back
+			sx += srcWidth / 2
+			sy += srcHeight / 2
+
+			// Get pixel from source if within bounds
+			if sx >= 0 && sx < srcWidth && sy >= 0 && sy < srcHeight {
+				dst.Set(x, y, sample(src, sx+float64(srcBounds.Min.X), sy+float64(srcBounds.Min.Y)))
+			}
+		}
+	}
+}
+
+// WritePreview renders only frame index of the animation (counting in output
+// order, so after any -reverse) and encodes it to w as a PNG, in full color
+// before palette conversion.
+func WritePreview(w io.Writer, img image.Image, effects []EffectSpec, index int, opts Options) error {
+	opts = opts.withDefaults()
+	frameIdx := index
+	if opts.Reverse {
+		frameIdx = opts.Frames - 1 - index
+	}
+	img, opts = renderInputs(img, effects, opts)
+	frame, _, err := renderOutputFrame(img, effects, frameIdx, opts, &frameBuffers{})
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, frame)
+}
+
+// EncodeGIF renders the animation of the parsed effects and encodes it to w
+// with the given palette (see BuildPalette), one frame at a time, so only a
+// handful of frames are in memory at once. Unlike WriteGIF it doesn't check
+// the options, which should have passed Validate; fields left zero take
+// their defaults as they do there.
+func EncodeGIF(w io.Writer, img image.Image, effects []EffectSpec, palette color.Palette, opts Options) error {
+	opts = opts.withDefaults()
+	// Reserve a transparent palette entry for unchanged pixels
+	var transparentIndex uint8
+	if opts.Optimize {
+		palette, transparentIndex = reserveTransparent(palette)
+	}
+
+	bounds := img.Bounds()
+	enc := newGIFStreamEncoder(w, bounds.Dx(), bounds.Dy(), palette, opts.Comment)
+
+	// Pixels outside the region an effect changed are the same as the input
+	// image's, so its conversion can be reused. Error diffusion depends on
+	// neighboring pixels, so Floyd-Steinberg frames are always converted whole
+	var static *image.Paletted
+	if opts.Dither != "floyd" {
+		static = toPaletted(ToRGBA(img), palette, opts.Dither, opts.AlphaThreshold)
+	}
+
+	// Convert frames to the palette as they are rendered, then encode them
+	var prev *image.Paletted
+	frameIdx := 0
+	delay := func() int {
+		d := frameDelay(opts.Delay, frameIdx)
+		frameIdx++
+		return d
+	}
+	convert := func(frame *image.RGBA, dirty image.Rectangle) *image.Paletted {
+		if static == nil || static.Bounds() != frame.Bounds() || dirty == frame.Bounds() {
+			return toPaletted(frame, palette, opts.Dither, opts.AlphaThreshold)
+		}
+		paletted := image.NewPaletted(frame.Bounds(), palette)
+		copy(paletted.Pix, static.Pix)
+		if !dirty.Empty() {
+			copyPaletted(paletted, toPaletted(frame.SubImage(dirty).(*image.RGBA), palette, opts.Dither, opts.AlphaThreshold))
+		}
+		return paletted
+	}
+	if !opts.Optimize {
+		err := renderFrames(img, effects, opts, convert, func(frame *image.Paletted) error {
+			return enc.WriteFrame(frame, delay(), opts.Disposal)
+		})
+		if err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	// Optimized frames only hold the changed region and are drawn over the
+	// frames before them, which can't make a pixel transparent again. So
+	// each frame is held back until the next one is known: if the next one
+	// uncovers any pixels, the held frame is written whole and cleared to
+	// the background once shown, and the next one starts afresh.
+	var first, held *image.Paletted
+	heldDelay := 0
+	writeHeld := func(next *image.Paletted) error {
+		if uncovers(prev, next) {
+			return enc.WriteFrame(prev, heldDelay, gif.DisposalBackground)
+		}
+		return enc.WriteFrame(held, heldDelay, gif.DisposalNone)
+	}
+	err := renderFrames(img, effects, opts, convert, func(frame *image.Paletted) error {
+		if prev == nil {
+			first, held = frame, frame
+		} else {
+			if err := writeHeld(frame); err != nil {
+				return err
+			}
+			held = frame
+			if !uncovers(prev, frame) {
+				held = optimizeFrame(prev, frame, transparentIndex)
+			}
+		}
+		prev = frame
+		heldDelay = delay()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The first frame follows the last one when the animation loops
+	if held != nil {
+		if err := writeHeld(first); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// uncovers reports whether any pixel that is opaque in prev is transparent in
+// next. Both frames must share a palette.
+func uncovers(prev, next *image.Paletted) bool {
+	transparent := make([]bool, len(prev.Palette))
+	for i, c := range prev.Palette {
+		_, _, _, a := c.RGBA()
+		transparent[i] = a == 0
+	}
+	for i, idx := range next.Pix {
+		if transparent[idx] && !transparent[prev.Pix[i]] {
+			return true
+		}
+	}
+	return false
+}
+
+// frameDelay returns the delay of the frame at the given position, in whole
+// 100ths of a second, for frames an average of delay apart. Delays alternate
+// between rounding down and up so that the elapsed time at every frame is as
+// close as possible to the exact value, e.g. 13, 12, 13, 12 for 8fps.
+func frameDelay(delay float64, frameIdx int) int {
+	start := math.Round(float64(frameIdx) * delay)
+	end := math.Round(float64(frameIdx+1) * delay)
+	return int(end - start)
+}
@@ -0,0 +1,1097 @@
+package animoji
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden frames in testdata/golden instead of comparing against them")
+
+// goldenTolerance is how far each channel of a rendered pixel may be from
+// the golden one, to allow for floating point differences between platforms.
+const goldenTolerance = 2
+
+// solidImage returns a w x h image filled with c.
+func solidImage(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+// testFrames renders frameCount frames of the effects applied in turn to
+// img.
+func testFrames(t testing.TB, img image.Image, effects []string, frameCount int, opts Options) []*image.RGBA {
+	t.Helper()
+	opts.Frames = frameCount
+	generated, err := GenerateFrames(img, effects, opts)
+	if err != nil {
+		t.Fatalf("GenerateFrames: %v", err)
+	}
+	frames := make([]*image.RGBA, len(generated))
+	for i, frame := range generated {
+		frames[i] = frame.(*image.RGBA)
+	}
+	return frames
+}
+
+// testGIF encodes the animation of the effects applied in turn to img, and
+// decodes it again.
+func testGIF(t testing.TB, img image.Image, effects []string, opts Options) *gif.GIF {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteGIF(&buf, img, effects, opts); err != nil {
+		t.Fatalf("WriteGIF: %v", err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("decoding the GIF: %v", err)
+	}
+	return anim
+}
+
+// toTestRGBA returns img as an *image.RGBA, converting it if needed.
+func toTestRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
+
+func TestKaleidoscopeSolid(t *testing.T) {
+	// Every point of the pattern maps back into the image, so a solid
+	// image stays solid, without dark seams or corners
+	c := color.RGBA{200, 100, 50, 255}
+	for i, frame := range testFrames(t, solidImage(33, 32, c), []string{"kaleidoscope"}, 6, DefaultOptions()) {
+		bounds := frame.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if got := frame.RGBAAt(x, y); got != c {
+					t.Fatalf("frame %d: pixel (%d,%d) is %v, want %v", i, x, y, got, c)
+				}
+			}
+		}
+	}
+}
+
+// goldenInput returns the fixed image the golden frames are rendered from: a
+// disc shaded with hues and brightness so that color, tone and movement
+// effects all show, on a transparent background for the effects that
+// outline or uncover it.
+func goldenInput() *image.RGBA {
+	const size = 32
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			dx, dy := float64(x)-15.5, float64(y)-15.5
+			if dx*dx+dy*dy > 14*14 {
+				continue
+			}
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 8), uint8(y * 8), uint8(255 - x*4 - y*4), 255})
+		}
+	}
+	return img
+}
+
+// channelDiff returns the largest difference between the channels of a and b.
+func channelDiff(a, b color.RGBA) int {
+	diff := func(a, b uint8) int {
+		return max(int(a)-int(b), int(b)-int(a))
+	}
+	return max(diff(a.R, b.R), diff(a.G, b.G), diff(a.B, b.B), diff(a.A, b.A))
+}
+
+// compareGolden compares got with the PNG at path, or rewrites the PNG with
+// got when the tests are run with -update. got is compared as it reads back
+// from a PNG, so that both go through the same conversion.
+func compareGolden(t *testing.T, got *image.RGBA, path string) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, got); err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	encoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = toTestRGBA(encoded)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v (run the tests with -update to create it)", err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", path, err)
+	}
+	want := toTestRGBA(decoded)
+
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("got a %v image, golden %s is %v", got.Bounds(), path, want.Bounds())
+	}
+	bad := 0
+	bounds := got.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			g, w := got.RGBAAt(x, y), want.RGBAAt(x, y)
+			if channelDiff(g, w) <= goldenTolerance {
+				continue
+			}
+			if bad < 5 {
+				t.Errorf("pixel (%d,%d) is %v, golden has %v", x, y, g, w)
+			}
+			bad++
+		}
+	}
+	if bad > 0 {
+		t.Errorf("%d pixels differ from %s (run the tests with -update if the change is intended)", bad, path)
+	}
+}
+
+func TestGoldenFrames(t *testing.T) {
+	img := goldenInput()
+	for _, info := range Effects {
+		t.Run(info.Name, func(t *testing.T) {
+			opts := DefaultOptions()
+			if info.Name == "morph" {
+				opts.Image2 = solidImage(32, 32, color.RGBA{255, 160, 0, 255})
+			}
+			frames := testFrames(t, img, []string{info.Name}, 4, opts)
+
+			// Lay the frames out side by side in one image
+			size := img.Bounds().Size()
+			strip := image.NewRGBA(image.Rect(0, 0, size.X*len(frames), size.Y))
+			for i, frame := range frames {
+				draw.Draw(strip, frame.Bounds().Add(image.Pt(i*size.X, 0)), frame, frame.Bounds().Min, draw.Src)
+			}
+			compareGolden(t, strip, filepath.Join("testdata", "golden", info.Name+".png"))
+		})
+	}
+}
+
+func BenchmarkRenderFrame(b *testing.B) {
+	img, err := ResizeImage(goldenInput(), 128)
+	if err != nil {
+		b.Fatalf("ResizeImage: %v", err)
+	}
+	opts := DefaultOptions()
+	opts.Frames = 12
+	specs, opts, err := parseEffects(img, []string{"ripple", "hue", "zoom"}, opts)
+	if err != nil {
+		b.Fatalf("parseEffects: %v", err)
+	}
+
+	// Rendering into reused buffers saves allocating the full-size images
+	// for each effect on every frame, which shows in B/op; most of the
+	// remaining allocations are single pixels boxed by image.Image.At
+	for _, bench := range []struct {
+		name  string
+		reuse bool
+	}{
+		{"reused", true},
+		{"fresh", false},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var buf *frameBuffers
+			if bench.reuse {
+				buf = &frameBuffers{}
+			}
+			for i := 0; b.Loop(); i++ {
+				if _, _, err := renderFrame(img, specs, i%opts.Frames, opts.Frames, opts, buf); err != nil {
+					b.Fatalf("renderFrame: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeDeepAndGrayPNG(t *testing.T) {
+	// Blocks of 4x4 pixels, so that every color is sampled for the palette
+	deep := image.NewRGBA64(image.Rect(0, 0, 16, 16))
+	gray := image.NewGray(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			deep.SetRGBA64(x, y, color.RGBA64{uint16(x/4) * 0x4141, uint16(y/4) * 0x3f3f, 0xfedc, 0xffff})
+			gray.SetGray(x, y, color.Gray{uint8(x/4*60 + y/4)})
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		img  image.Image
+	}{
+		{"16-bit", deep},
+		{"grayscale", gray},
+	} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, tt.img); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := LoadImageFromReader(&buf, true)
+		if err != nil {
+			t.Fatalf("%s: LoadImageFromReader: %v", tt.name, err)
+		}
+
+		// The palette holds 8-bit colors, and the first frame, with the
+		// hue not yet shifted, keeps the image's colors exactly
+		opts := DefaultOptions()
+		opts.Frames = 4
+		frame := testGIF(t, decoded, []string{"hue"}, opts).Image[0]
+		for y := range 16 {
+			for x := range 16 {
+				want := color.RGBAModel.Convert(tt.img.At(x, y)).(color.RGBA)
+				if got := color.RGBAModel.Convert(frame.At(x, y)).(color.RGBA); got != want {
+					t.Errorf("%s: pixel (%d,%d) is %v, want %v", tt.name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestHueTransparentBorder(t *testing.T) {
+	// A green sprite with a half transparent rim, inside a transparent
+	// border that still holds color, as non-premultiplied images can
+	sprite := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			c := color.NRGBA{255, 0, 0, 0}
+			switch {
+			case x >= 5 && x < 11 && y >= 5 && y < 11:
+				c = color.NRGBA{0, 255, 0, 255}
+			case x >= 4 && x < 12 && y >= 4 && y < 12:
+				c = color.NRGBA{0, 255, 0, 128}
+			}
+			sprite.SetNRGBA(x, y, c)
+		}
+	}
+
+	// The second of two frames is shifted 180 degrees, turning green into
+	// magenta
+	frame := testFrames(t, sprite, []string{"hue"}, 2, DefaultOptions())[1]
+	for y := range 16 {
+		for x := range 16 {
+			got := frame.RGBAAt(x, y)
+			var want color.RGBA
+			switch {
+			case x >= 5 && x < 11 && y >= 5 && y < 11:
+				want = color.RGBA{255, 0, 255, 255}
+			case x >= 4 && x < 12 && y >= 4 && y < 12:
+				want = color.RGBA{128, 0, 128, 128}
+			}
+			if max(got.R, got.G, got.B) > got.A {
+				t.Errorf("pixel (%d,%d) is %v, with color brighter than its alpha", x, y, got)
+			}
+			if channelDiff(got, want) > 1 {
+				t.Errorf("pixel (%d,%d) is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestFrameDelay(t *testing.T) {
+	for _, tt := range []struct {
+		rate float64
+		want []int
+	}{
+		{7, []int{14, 15, 14, 14, 14, 15, 14}},
+		{8, []int{13, 12, 13, 12}},
+		{100, []int{1, 1, 1, 1}},
+		{7.5, []int{13, 14, 13, 13, 14, 13}},
+		{3, []int{33, 34, 33}},
+	} {
+		var got []int
+		for i := range tt.want {
+			got = append(got, frameDelay(100/tt.rate, i))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("delays at %gfps are %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+
+	// Over a long loop the delays add up to the exact time, so the average
+	// rate is the one asked for
+	for _, rate := range []float64{7, 8, 7.5, 12.3, 29.97, 100} {
+		total := 0
+		for i := range 1000 {
+			total += frameDelay(100/rate, i)
+		}
+		if want := 1000 * 100 / rate; math.Abs(float64(total)-want) > 0.5 {
+			t.Errorf("1000 frames at %gfps last %d, want %g", rate, total, want)
+		}
+	}
+
+	// The delays reach the GIF
+	img := solidImage(8, 8, color.RGBA{255, 0, 0, 255})
+	opts := DefaultOptions()
+	opts.Frames = 4
+	opts.Delay = 100.0 / 8
+	anim := testGIF(t, img, []string{"hue"}, opts)
+	if want := []int{13, 12, 13, 12}; !slices.Equal(anim.Delay, want) {
+		t.Errorf("GIF delays at 8fps are %v, want %v", anim.Delay, want)
+	}
+
+	// Faster than 100fps would need delays under one
+	opts.Delay = 100.0 / 101
+	if err := WriteGIF(io.Discard, img, []string{"hue"}, opts); err == nil {
+		t.Errorf("101fps: expected an error")
+	}
+}
+
+func TestDecodeFormats(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			img.SetRGBA(x, y, color.RGBA{uint8(x / 4 * 80), uint8(y / 4 * 80), 200, 255})
+		}
+	}
+	encode := func(encoder func(io.Writer, image.Image) error) []byte {
+		var buf bytes.Buffer
+		if err := encoder(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	webpData, err := os.ReadFile(filepath.Join("testdata", "gopher.webp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"bmp", encode(bmp.Encode)},
+		{"tiff", encode(func(w io.Writer, m image.Image) error { return tiff.Encode(w, m, nil) })},
+		{"webp", webpData},
+	} {
+		decoded, err := LoadImageFromReader(bytes.NewReader(tt.data), true)
+		if err != nil {
+			t.Errorf("%s: LoadImageFromReader: %v", tt.name, err)
+			continue
+		}
+		if tt.name != "webp" && decoded.Bounds() != img.Bounds() {
+			t.Errorf("%s: decoded %v, want %v", tt.name, decoded.Bounds(), img.Bounds())
+			continue
+		}
+
+		// The first frame of hue is the image as it was
+		opts := DefaultOptions()
+		opts.Frames = 3
+		anim := testGIF(t, decoded, []string{"hue"}, opts)
+		want := ToRGBA(decoded)
+		bounds := want.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if got := color.RGBAModel.Convert(anim.Image[0].At(x, y)).(color.RGBA); got != want.RGBAAt(x, y) {
+					t.Fatalf("%s: pixel (%d,%d) is %v, want %v", tt.name, x, y, got, want.RGBAAt(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeGIF(t *testing.T) {
+	palette := color.Palette{color.RGBA{0, 0, 0, 255}, color.RGBA{255, 80, 0, 255}}
+	frame := image.NewPaletted(image.Rect(0, 0, 8, 8), palette)
+	frame.SetColorIndex(3, 5, 1)
+	encode := func(frames int) []byte {
+		anim := &gif.GIF{}
+		for range frames {
+			anim.Image = append(anim.Image, frame)
+			anim.Delay = append(anim.Delay, 10)
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	img, err := LoadImageFromReader(bytes.NewReader(encode(1)), true)
+	if err != nil {
+		t.Fatalf("LoadImageFromReader: %v", err)
+	}
+	if img.Bounds() != frame.Bounds() {
+		t.Fatalf("decoded %v, want %v", img.Bounds(), frame.Bounds())
+	}
+	if got := color.RGBAModel.Convert(img.At(3, 5)); got != palette[1] {
+		t.Errorf("pixel (3,5) is %v, want %v", got, palette[1])
+	}
+
+	if _, err := LoadImageFromReader(bytes.NewReader(encode(2)), true); err == nil || !strings.Contains(err.Error(), "animated") {
+		t.Errorf("animated GIF: got error %v, want one saying it is animated", err)
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want color.RGBA
+	}{
+		{"#ff8800", color.RGBA{255, 136, 0, 255}},
+		{"FF8800", color.RGBA{255, 136, 0, 255}},
+		{"#f80", color.RGBA{255, 136, 0, 255}},
+		{"f80", color.RGBA{255, 136, 0, 255}},
+		{"#f80f", color.RGBA{255, 136, 0, 255}},
+		{"#f808", color.RGBA{136, 72, 0, 136}},
+		{"#ff880080", color.RGBA{128, 68, 0, 128}},
+		{"#ffffff00", color.RGBA{0, 0, 0, 0}},
+		{"orange", color.RGBA{255, 165, 0, 255}},
+		{"Orange", color.RGBA{255, 165, 0, 255}},
+	} {
+		got, err := ParseHexColor(tt.in)
+		if err != nil {
+			t.Errorf("ParseHexColor(%q): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("ParseHexColor(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "#", "#ff", "#fffff", "#fffffff", "#fffffffff", "#ggg", "#-fffff", "0x1234", "#f 8", "notacolor"} {
+		if got, err := ParseHexColor(in); err == nil {
+			t.Errorf("ParseHexColor(%q) = %v, expected an error", in, got)
+		}
+	}
+}
+
+func TestOptionsAt(t *testing.T) {
+	opts := Options{
+		GlowIntensity: 7,
+		HeatAmplitude: 3,
+		Ramps:         map[string][2]float64{"glow-intensity": {0, 2}, "bounce-height": {1, 0.5}},
+		Easing:        "linear",
+		Spins:         1,
+		HueCycles:     1,
+	}
+	for _, tt := range []struct {
+		t            float64
+		glow, bounce float64
+	}{
+		{0, 0, 1},
+		{0.25, 0.5, 0.875},
+		{0.5, 1, 0.75},
+		{1, 2, 0.5},
+	} {
+		got := opts.at(tt.t)
+		if got.GlowIntensity != tt.glow || got.BounceHeight != tt.bounce {
+			t.Errorf("at(%g) gives glow %g and bounce %g, want %g and %g", tt.t, got.GlowIntensity, got.BounceHeight, tt.glow, tt.bounce)
+		}
+		if got.HeatAmplitude != 3 {
+			t.Errorf("at(%g) changed heat amplitude, which has no range, to %g", tt.t, got.HeatAmplitude)
+		}
+	}
+	if opts.GlowIntensity != 7 {
+		t.Errorf("at changed the options it was called on")
+	}
+
+	// Easing bends the ramp but keeps its ends
+	opts.Easing = "ease-in"
+	if got := opts.at(0.5).GlowIntensity; got >= 1 {
+		t.Errorf("ease-in is at %g halfway, want under 1", got)
+	}
+	if got := opts.at(1).GlowIntensity; got != 2 {
+		t.Errorf("ease-in ends at %g, want 2", got)
+	}
+}
+
+func TestOrderedDitherStable(t *testing.T) {
+	// A smooth gradient that four colors can only approximate by dithering
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := range 32 {
+		for x := range 32 {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 8), uint8(y * 8), 128, 255})
+		}
+	}
+	render := func(dither string) *gif.GIF {
+		opts := DefaultOptions()
+		opts.Frames = 3
+		opts.Colors = 4
+		opts.Dither = dither
+		return testGIF(t, img, nil, opts)
+	}
+
+	anim := render("ordered")
+	first := anim.Image[0]
+	if bytes.Equal(first.Pix, render("none").Image[0].Pix) {
+		t.Fatalf("the frame isn't dithered")
+	}
+	for i, frame := range anim.Image[1:] {
+		if frame.Bounds() != first.Bounds() || !bytes.Equal(frame.Pix, first.Pix) {
+			t.Errorf("frame %d is dithered differently from frame 0", i+1)
+		}
+	}
+}
+
+func TestAntialiasedCircleCorners(t *testing.T) {
+	// A circle with a soft edge, fading from opaque to transparent over
+	// about two pixels
+	img := image.NewRGBA(image.Rect(0, 0, 24, 24))
+	for y := range 24 {
+		for x := range 24 {
+			dx, dy := float64(x)-11.5, float64(y)-11.5
+			a := math.Max(0, math.Min(1, (10-math.Hypot(dx, dy))/2))
+			img.SetRGBA(x, y, color.RGBA{uint8(200 * a), uint8(40 * a), uint8(90 * a), uint8(255 * a)})
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.Frames = 3
+	for i, frame := range testGIF(t, img, []string{"hue"}, opts).Image {
+		for y := range 24 {
+			for x := range 24 {
+				_, _, _, a := frame.At(x, y).RGBA()
+				switch src := img.RGBAAt(x, y).A; {
+				case src < 128 && a != 0:
+					t.Errorf("frame %d: pixel (%d,%d) with alpha %d is opaque", i, x, y, src)
+				case src >= 128 && a != 0xffff:
+					t.Errorf("frame %d: pixel (%d,%d) with alpha %d is transparent", i, x, y, src)
+				}
+			}
+		}
+	}
+}
+
+func TestClamp8(t *testing.T) {
+	for _, tt := range []struct {
+		in   float64
+		want uint8
+	}{
+		{-1e9, 0},
+		{-256, 0},
+		{-0.5, 0},
+		{0, 0},
+		{127.9, 127},
+		{255, 255},
+		{255.5, 255},
+		{256, 255},
+		{511, 255},
+		{1e9, 255},
+	} {
+		if got := clamp8(tt.in); got != tt.want {
+			t.Errorf("clamp8(%g) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	// Blends and effects that push channels past either end saturate
+	// rather than wrapping around
+	white := solidImage(16, 16, color.White)
+	black := solidImage(16, 16, color.Black)
+	dst := image.NewRGBA(white.Bounds())
+	for _, tt := range []struct {
+		name  string
+		apply func()
+		want  color.RGBA
+	}{
+		{"blend past the end", func() { blendImages(dst, black, white, 1.5) }, color.RGBA{255, 255, 255, 255}},
+		{"blend before the start", func() { blendImages(dst, white, black, 1.5) }, color.RGBA{0, 0, 0, 255}},
+		{"glow over white", func() { applyGlow(dst, white, 120, 2, 5) }, color.RGBA{255, 255, 255, 255}},
+		{"tint over white", func() { applyTint(dst, white, 0) }, color.RGBA{255, 127, 127, 255}},
+		{"spotlight past full", func() { applySpotlight(dst, white, 8, 8, 100, color.RGBA{255, 255, 0, 255}, 1.5) }, color.RGBA{255, 255, 0, 255}},
+		{"cmyk over white", func() { applyCMYKShift(dst, white, [4]image.Point{{1, 0}, {0, 1}, {-1, 0}, {0, 0}}) }, color.RGBA{255, 255, 255, 255}},
+		{"zoomblur over white", func() { applyZoomBlur(dst, white, 0.5, 8, sampleBilinear) }, color.RGBA{255, 255, 255, 255}},
+	} {
+		clear(dst.Pix)
+		tt.apply()
+		if got := dst.RGBAAt(8, 8); channelDiff(got, tt.want) > 1 {
+			t.Errorf("%s: center pixel is %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPaletteKeepsTint(t *testing.T) {
+	// A blue-green image with far more colors than fit in a palette, and no
+	// red at all
+	img := image.NewRGBA(image.Rect(0, 0, 96, 96))
+	for y := range 96 {
+		for x := range 96 {
+			img.SetRGBA(x, y, color.RGBA{0, uint8(x * 255 / 95), uint8(y * 255 / 95), 255})
+		}
+	}
+
+	// The first frame is tinted red at 50%, so every pixel has a red
+	// channel of about 127
+	opts := DefaultOptions()
+	opts.Frames = 4
+	frame := testGIF(t, img, []string{"tint-rgb"}, opts).Image[0]
+	for _, p := range []image.Point{{0, 0}, {48, 48}, {95, 95}, {10, 80}} {
+		r, _, _, _ := frame.At(p.X, p.Y).RGBA()
+		if r>>8 < 100 {
+			t.Errorf("pixel %v has red %d after paletting, want about 127", p, r>>8)
+		}
+	}
+}
+
+func TestSingleFrame(t *testing.T) {
+	img := goldenInput()
+	for _, info := range Effects {
+		t.Run(info.Name, func(t *testing.T) {
+			opts := DefaultOptions()
+			if info.Name == "morph" {
+				opts.Image2 = solidImage(32, 32, color.RGBA{255, 160, 0, 255})
+			}
+			frames := testFrames(t, img, []string{info.Name}, 1, opts)
+			if len(frames) != 1 {
+				t.Fatalf("got %d frames, want 1", len(frames))
+			}
+			frame := frames[0]
+			if frame.Bounds() != img.Bounds() {
+				t.Fatalf("frame is %v, want %v", frame.Bounds(), img.Bounds())
+			}
+
+			// The lone frame shows the effect at its start, so the
+			// middle of the disc is still there, in a valid color
+			visible := 0
+			for y := 0; y < 32; y++ {
+				for x := 0; x < 32; x++ {
+					c := frame.RGBAAt(x, y)
+					if max(c.R, c.G, c.B) > c.A {
+						t.Fatalf("pixel (%d,%d) is %v, with color brighter than its alpha", x, y, c)
+					}
+					if c.A > 0 {
+						visible++
+					}
+				}
+			}
+			if visible < 100 {
+				t.Errorf("only %d pixels are visible", visible)
+			}
+		})
+	}
+}
+
+func TestFramesIndependent(t *testing.T) {
+	img := goldenInput()
+	chain := []string{"ripple", "hue", "zoom"}
+	opts := DefaultOptions()
+	opts.Jobs = 1
+	frames := testFrames(t, img, chain, 6, opts)
+	opts.Jobs = 4
+	want := testFrames(t, img, chain, 6, opts)
+
+	// Scribbling over one frame must leave the others, and the input,
+	// as they were
+	draw.Draw(frames[2], frames[2].Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for i, frame := range frames {
+		if i == 2 {
+			continue
+		}
+		if !bytes.Equal(frame.Pix, want[i].Pix) {
+			t.Errorf("frame %d changed when frame 2 was overwritten", i)
+		}
+	}
+	if !bytes.Equal(img.Pix, goldenInput().Pix) {
+		t.Errorf("the input image was modified")
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	img := goldenInput()
+	opts := DefaultOptions()
+	opts.Frames = 4
+	specs, opts, err := parseEffects(img, []string{"gradientmap", "tint-rgb", "pixelate"}, opts)
+	if err != nil {
+		t.Fatalf("parseEffects: %v", err)
+	}
+
+	// Each effect takes the previous one's output, so rendering the chain
+	// with reused buffers matches applying the effects one at a time
+	var buf frameBuffers
+	for i := range opts.Frames {
+		chained, _, err := renderFrame(img, specs, i, opts.Frames, opts, &buf)
+		if err != nil {
+			t.Fatalf("rendering frame %d: %v", i, err)
+		}
+		var stepped image.Image = img
+		for _, spec := range specs {
+			out, _, err := renderFrame(stepped, []EffectSpec{spec}, i, opts.Frames, opts, nil)
+			if err != nil {
+				t.Fatalf("rendering frame %d of %s: %v", i, spec.Name, err)
+			}
+			stepped = out
+		}
+		if !bytes.Equal(chained.Pix, stepped.(*image.RGBA).Pix) {
+			t.Errorf("frame %d of the chain differs from applying its effects in turn", i)
+		}
+	}
+
+	// and so swapping two effects changes the result
+	ab := testFrames(t, img, []string{"gradientmap", "tint-rgb"}, 4, DefaultOptions())
+	ba := testFrames(t, img, []string{"tint-rgb", "gradientmap"}, 4, DefaultOptions())
+	for i := range ab {
+		if bytes.Equal(ab[i].Pix, ba[i].Pix) {
+			t.Errorf("frame %d of gradientmap tint-rgb matches tint-rgb gradientmap", i)
+		}
+	}
+}
+
+func TestDegenerateInputs(t *testing.T) {
+	strip := image.NewRGBA(image.Rect(0, 0, 5, 1))
+	for x := range 5 {
+		strip.SetRGBA(x, 0, color.RGBA{uint8(x * 60), 100, 200, 255})
+	}
+	for _, input := range []struct {
+		name string
+		img  *image.RGBA
+	}{
+		{"1x1 opaque", solidImage(1, 1, color.RGBA{200, 50, 50, 255})},
+		{"1x1 transparent", solidImage(1, 1, color.Transparent)},
+		{"5x1", strip},
+		{"solid", solidImage(16, 16, color.RGBA{20, 120, 220, 255})},
+	} {
+		for _, info := range Effects {
+			t.Run(input.name+"/"+info.Name, func(t *testing.T) {
+				opts := DefaultOptions()
+				opts.Frames = 3
+				if info.Name == "morph" {
+					opts.Image2 = solidImage(input.img.Bounds().Dx(), input.img.Bounds().Dy(), color.White)
+				}
+				var buf bytes.Buffer
+				err := WriteGIF(&buf, input.img, []string{info.Name}, opts)
+				if info.Name == "360" && input.img.Bounds().Dx() != input.img.Bounds().Dy() {
+					// 360 turns the image through angles a non-square
+					// image doesn't fit at
+					if err == nil {
+						t.Fatalf("expected an error for a non-square image")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("WriteGIF: %v", err)
+				}
+				anim, err := gif.DecodeAll(&buf)
+				if err != nil {
+					t.Fatalf("decoding the GIF: %v", err)
+				}
+				if len(anim.Image) != 3 {
+					t.Fatalf("got %d frames, want 3", len(anim.Image))
+				}
+				size := input.img.Bounds().Size()
+				if anim.Config.Width != size.X || anim.Config.Height != size.Y {
+					t.Errorf("GIF is %dx%d, want %v", anim.Config.Width, anim.Config.Height, size)
+				}
+			})
+		}
+	}
+}
+
+func TestASCIIDefaults(t *testing.T) {
+	img := solidImage(16, 16, color.RGBA{200, 120, 40, 255})
+	frames, err := GenerateFrames(img, []string{"ascii"}, Options{Frames: 2})
+	if err != nil {
+		t.Fatalf("GenerateFrames: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+
+	for _, tt := range []struct {
+		name string
+		opts Options
+	}{
+		{"cell too small", Options{Frames: 2, ASCIICell: 1}},
+		{"empty ramp", Options{Frames: 2, ASCIIRamp: []rune{}}},
+		{"unprintable ramp", Options{Frames: 2, ASCIIRamp: []rune("ab\x01")}},
+	} {
+		if _, err := GenerateFrames(img, []string{"ascii"}, tt.opts); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestDefaultOptions(t *testing.T) {
+	// DefaultOptions already sets every field that withDefaults fills in,
+	// to the same value
+	opts := DefaultOptions()
+	got := opts.withDefaults()
+	if !reflect.DeepEqual(got, opts) {
+		t.Errorf("withDefaults changed DefaultOptions:\n got %+v\nwant %+v", got, opts)
+	}
+	if err := opts.Validate(); err != nil {
+		t.Errorf("DefaultOptions are invalid: %v", err)
+	}
+}
+
+func TestApplyBytesZeroOptions(t *testing.T) {
+	// Zero options are valid, though effects such as pinch then have no
+	// strength and the ones with defaults take the flag defaults
+	img := solidImage(12, 12, color.RGBA{40, 160, 220, 255})
+	for _, info := range Effects {
+		t.Run(info.Name, func(t *testing.T) {
+			data, err := ApplyBytes(img, []string{info.Name}, Options{Frames: 3})
+			if info.Name == "morph" {
+				// morph has nothing to dissolve into without Image2
+				if err == nil {
+					t.Fatalf("expected an error without a second image")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyBytes: %v", err)
+			}
+			if len(data) == 0 {
+				t.Fatalf("ApplyBytes returned no data")
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name string
+		opts Options
+	}{
+		{"no frames", Options{}},
+		{"unknown ramp", Options{Frames: 3, Ramps: map[string][2]float64{"frames": {1, 2}}}},
+		{"one gradient stop", Options{Frames: 3, GradientStops: []color.RGBA{{255, 0, 0, 255}}}},
+		{"negative pixelate grid", Options{Frames: 3, PixelateGrid: -1}},
+		{"negative ramp end", Options{Frames: 3, Ramps: map[string][2]float64{"heat-amplitude": {3, -1}}}},
+	} {
+		if _, err := ApplyBytes(img, []string{"gradientmap"}, tt.opts); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+// playGIF composites the frames of anim as a viewer shows them, following
+// their disposal methods, for two loops of the animation.
+func playGIF(anim *gif.GIF) []*image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, anim.Config.Width, anim.Config.Height))
+	var shown []*image.RGBA
+	for range 2 {
+		for i, frame := range anim.Image {
+			before := ToRGBA(canvas)
+			draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+			shown = append(shown, ToRGBA(canvas))
+			switch anim.Disposal[i] {
+			case gif.DisposalBackground:
+				draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+			case gif.DisposalPrevious:
+				canvas = before
+			}
+		}
+	}
+	return shown
+}
+
+func TestOptimizeUncovered(t *testing.T) {
+	img := goldenInput()
+	for _, tt := range []struct {
+		effect string
+		opts   Options
+	}{
+		{"bounce", Options{}},
+		{"grow", Options{}},
+		{"jelly", Options{}},
+		{"ripple", Options{RippleEdge: "transparent"}},
+		{"360", Options{}},
+		{"hue", Options{}},
+	} {
+		render := func(optimize bool) []*image.RGBA {
+			opts := tt.opts
+			opts.Frames = 6
+			opts.Optimize = optimize
+			data, err := ApplyBytes(img, []string{tt.effect}, opts)
+			if err != nil {
+				t.Fatalf("%s: ApplyBytes: %v", tt.effect, err)
+			}
+			anim, err := gif.DecodeAll(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("%s: decoding the GIF: %v", tt.effect, err)
+			}
+			return playGIF(anim)
+		}
+
+		// Whatever is left of earlier frames, the optimized GIF must look
+		// the same as the one with every frame in full
+		want := render(false)
+		for i, got := range render(true) {
+			if !bytes.Equal(got.Pix, want[i].Pix) {
+				t.Errorf("%s: frame %d of the optimized GIF shows something else", tt.effect, i%6)
+			}
+		}
+	}
+}
+
+func TestBursts(t *testing.T) {
+	img := goldenInput()
+	render := func(effects []string, bursts map[string]int) []image.Image {
+		frames, err := GenerateFrames(img, effects, Options{Frames: 6, Bursts: bursts, BurstLength: 1})
+		if err != nil {
+			t.Fatalf("GenerateFrames(%q): %v", effects, err)
+		}
+		return frames
+	}
+
+	// Only the named effect is held back between its bursts
+	burst := render([]string{"tint-rgb", "channel"}, map[string]int{"tint-rgb": 3})
+	always := render([]string{"tint-rgb", "channel"}, nil)
+	never := render([]string{"channel"}, nil)
+	for i, frame := range burst {
+		want := never[i]
+		if i%3 == 0 {
+			want = always[i]
+		}
+		if !bytes.Equal(frame.(*image.RGBA).Pix, want.(*image.RGBA).Pix) {
+			t.Errorf("frame %d doesn't match the chain with tint-rgb %s", i, map[bool]string{true: "on", false: "off"}[i%3 == 0])
+		}
+	}
+
+	for _, bursts := range []map[string]int{
+		{"no-such-effect": 3},
+		{"zoom": 3},
+		{"tint-rgb": 0},
+	} {
+		if _, err := GenerateFrames(img, []string{"tint-rgb"}, Options{Frames: 6, Bursts: bursts}); err == nil {
+			t.Errorf("bursts %v: expected an error", bursts)
+		}
+	}
+}
+
+func TestSupersampleKeepsSizes(t *testing.T) {
+	img := goldenInput()
+	for _, effect := range []string{"ripple", "heat", "reflect", "rgbjitter", "cmyk", "outline", "ascii"} {
+		t.Run(effect, func(t *testing.T) {
+			opts := Options{
+				Frames: 4, Seed: 1, Quality: "fast",
+				HeatAmplitude: 3, ReflectRipple: 3, JitterAmount: 3, CMYKOffset: 3,
+				OutlineColor: color.RGBA{255, 255, 255, 255},
+			}
+			want, err := GenerateFrames(img, []string{effect}, opts)
+			if err != nil {
+				t.Fatalf("GenerateFrames: %v", err)
+			}
+			opts.Supersample = 2
+			got, err := GenerateFrames(img, []string{effect}, opts)
+			if err != nil {
+				t.Fatalf("GenerateFrames supersampled: %v", err)
+			}
+
+			// Supersampling only smooths edges, so on average the frames
+			// should barely change. Sizes left in rendered pixels would
+			// halve, and the frames would differ by twice as much or more.
+			total, count := 0, 0
+			for i := range want {
+				w, g := want[i].(*image.RGBA), got[i].(*image.RGBA)
+				for y := range w.Bounds().Dy() {
+					for x := range w.Bounds().Dx() {
+						total += channelDiff(w.RGBAAt(x, y), g.RGBAAt(x, y))
+						count++
+					}
+				}
+			}
+			if mean := float64(total) / float64(count); mean > 9 {
+				t.Errorf("supersampled frames differ by %.1f per pixel on average, want at most 9", mean)
+			}
+		})
+	}
+}
+
+func TestJellySettles(t *testing.T) {
+	img := goldenInput()
+	frames, err := GenerateFrames(img, []string{"jelly"}, Options{Frames: 50, JellyDamping: 3})
+	if err != nil {
+		t.Fatalf("GenerateFrames: %v", err)
+	}
+
+	// The wobble dies down completely over the loop, so the last frame is
+	// all but the still image the first frame springs from
+	last := frames[len(frames)-1].(*image.RGBA)
+	worst := 0
+	for y := range 32 {
+		for x := range 32 {
+			worst = max(worst, channelDiff(last.RGBAAt(x, y), img.RGBAAt(x, y)))
+		}
+	}
+	if worst > 4 {
+		t.Errorf("last frame differs from the input by up to %d, want it at rest", worst)
+	}
+}
+
+func TestSampleNearestTruncates(t *testing.T) {
+	img := image.NewRGBA(image.Rect(10, 10, 13, 11))
+	for x := range 3 {
+		img.SetRGBA(10+x, 10, color.RGBA{uint8(x), 0, 0, 255})
+	}
+
+	// Points fall in the pixel they are inside, not the one they are
+	// nearest to, and points outside clamp to the edge
+	for _, tt := range []struct {
+		x    float64
+		want uint8
+	}{
+		{10, 0}, {10.9, 0}, {11, 1}, {11.5, 1}, {12.99, 2}, {9.5, 0}, {-3, 0}, {13.5, 2}, {100, 2},
+	} {
+		if got := sampleNearest(img, tt.x, 10.7).R; got != tt.want {
+			t.Errorf("sampleNearest at x %g gave pixel %d, want %d", tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestLoadImageFromURLLimit(t *testing.T) {
+	defer func(limit int64) { maxURLBytes = limit }(maxURLBytes)
+	maxURLBytes = 1 << 20
+
+	var small bytes.Buffer
+	if err := png.Encode(&small, solidImage(4, 4, color.White)); err != nil {
+		t.Fatal(err)
+	}
+	large := make([]byte, maxURLBytes+1)
+	copy(large, small.Bytes())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small.png":
+			w.Write(small.Bytes())
+		case "/large.png":
+			w.Header().Set("Content-Length", strconv.Itoa(len(large)))
+			w.Write(large)
+		case "/streamed.png":
+			// Without a Content-Length the limit is only found by reading
+			for i := 0; i < len(large); i += 4096 {
+				w.Write(large[i:min(i+4096, len(large))])
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer server.Close()
+
+	if _, err := LoadImageFromURL(server.URL+"/small.png", time.Minute, false); err != nil {
+		t.Errorf("small image: %v", err)
+	}
+	for _, path := range []string{"/large.png", "/streamed.png"} {
+		_, err := LoadImageFromURL(server.URL+path, time.Minute, false)
+		if err == nil || !strings.Contains(err.Error(), "larger than the 1 MB limit") {
+			t.Errorf("%s: got error %v, want the size limit", path, err)
+		}
+	}
+}
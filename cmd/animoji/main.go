@@ -0,0 +1,1270 @@
+// Command animoji creates animated GIFs from images with various animation
+// effects.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"animoji"
+)
+
+func main() {
+	var opts animoji.Options
+
+	inFile := flag.String("in", "", "Input image file or http(s) URL (PNG, JPEG, GIF, BMP, TIFF or WebP, or an .svg file)")
+	inFile2 := flag.String("in2", "", "Second input image file or http(s) URL, for the morph subcommand")
+	raw := flag.String("raw", "", "Read the input as raw RGBA pixels of the given size, WxH, instead of an encoded image")
+	noAutorotate := flag.Bool("no-autorotate", false, "Ignore the EXIF orientation of JPEG input")
+	timeout := flag.Duration("timeout", 30*time.Second, "Timeout for fetching an input image URL")
+	var outFiles stringList
+	flag.Var(&outFiles, "out", "Output GIF file (repeat to write the same GIF to several files)")
+	manifestFile := flag.String("manifest", "", "Write a JSON file describing the render (size, frames, delays, effects, palette, bytes)")
+	listEffectsFlag := flag.Bool("list-effects", false, "List the effects with their descriptions and the flags that tune them, and the aliases, then exit")
+	dryRun := flag.Bool("dry-run", false, "Check the input, flags and effects and print what would be rendered, without rendering")
+	check := flag.Bool("check", false, "Load the input, apply each effect to one frame and report every effect that fails, without writing a GIF")
+	debugStages := flag.String("debug-stages", "", "Directory to write the image after each effect to, for the -debug-frame frame")
+	debugFrame := flag.Int("debug-frame", 0, "Frame (0-based) whose stages -debug-stages writes")
+	preview := flag.Int("preview", -1, "Write only this frame (0-based) as a PNG instead of the GIF (-1 = off)")
+	opts.Ramps = map[string][2]float64{}
+	flag.IntVar(&opts.Frames, "frames", 12, "Number of frames in the animation")
+	rate := flag.Int("rate", 6, "Frame rate in frames per second")
+	rateFloat := flag.Float64("rate-float", 0, "Fractional frame rate in frames per second, overriding -rate (0 = use -rate)")
+	bpm := flag.Float64("bpm", 0, "Tempo in beats per minute to time the loop to, overriding -rate (0 = use -rate)")
+	beats := flag.Float64("beats", 1, "Number of beats one loop lasts with -bpm, e.g. 4 for a bar or 0.5 for half a beat")
+	speed := flag.Float64("speed", 1.0, "Playback speed of the animation (above 1 is faster, below 1 is slower)")
+	center := flag.String("center", "0.5,0.5", "Center of radial effects (kaleidoscope, ripple, pinch, twirl) as x,y fractions of the image")
+	flag.IntVar(&opts.Crossfade, "crossfade", 0, "Frames over which staged effects (name@start:end) blend into the next stage")
+	flag.BoolVar(&opts.Sync, "sync", false, "Keep looping effects in step across the whole animation, even when staged (name@start:end)")
+	var bursts stringList
+	flag.Var(&bursts, "burst", "Apply an effect only in short bursts, as name:every:N for a burst starting every N frames, showing its input unchanged in between (repeatable)")
+	flag.IntVar(&opts.BurstLength, "burst-length", 2, "Number of frames each -burst lasts")
+	maskFile := flag.String("mask", "", "Grayscale image limiting where effects apply (white = full effect, black = original)")
+	flag.BoolVar(&opts.Reverse, "reverse", false, "Reverse the order of frames")
+	resize := flag.Int("resize", 0, "Resize image to specified width (height scaled proportionally, 0 = no resize)")
+	trim := flag.Bool("trim", false, "Crop away a transparent (or -trim-color) border before resizing and applying effects")
+	trimColor := flag.String("trim-color", "", "Border color removed by -trim (default: transparent)")
+	trimTolerance := flag.Int("trim-tolerance", 0, "How far each channel (0-255) may differ from the -trim color and still be trimmed")
+	autopad := flag.Bool("autopad", false, "Pad non-square images to a square with transparent borders when using 360")
+	canvas := flag.String("canvas", "", "Output size as WxH, with the image centered on a transparent canvas (default: the image size)")
+	maxPixels := flag.Int64("max-pixels", 200_000_000, "Maximum total pixels to render (width x height x frames), 0 = unlimited")
+	maxBytes := flag.Int64("max-bytes", 0, "Shrink the GIF until it is at most this many bytes (0 = no limit)")
+	verbose := flag.Bool("verbose", false, "Print details of processing to stderr")
+	quiet := flag.Bool("quiet", false, "Don't print warnings")
+	flag.IntVar(&opts.Colors, "colors", 256, "Maximum number of colors in the palette (2-256)")
+	paletteFile := flag.String("palette", "", "Quantize to the colors of this palette instead of the image's: a .gpl GIMP palette or an image whose distinct pixel colors are used")
+	flag.IntVar(&opts.AlphaThreshold, "alpha-threshold", 128, "Pixels with alpha below this (0-255) become transparent in the GIF, the rest opaque")
+	flag.StringVar(&opts.Dither, "dither", "none", "Dithering of colors missing from the palette: ordered (stable across frames), floyd or none")
+	flag.StringVar(&opts.Quality, "quality", "good", "Sampling quality: fast (nearest neighbor), good (bilinear) or best (bilinear and -supersample 2)")
+	flag.IntVar(&opts.Supersample, "supersample", 1, "Render effects at N times the resolution and downscale for antialiasing, at N² times the time and memory")
+	flag.IntVar(&opts.Oversample, "oversample-frames", 1, "Render N subframes per frame and average them to motion-blur fast movement")
+	flag.StringVar(&opts.RippleMode, "ripple-mode", "radial", "Ripple wave shape: radial (from center) or linear (plane waves)")
+	flag.StringVar(&opts.RippleEdge, "ripple-edge", "clamp", "What ripple shows where waves pull in pixels from beyond the edges: clamp, wrap, reflect or transparent")
+	rampVar(&opts.RippleAngle, opts.Ramps, "ripple-angle", 0, "Direction of linear ripple waves in degrees (0 = left to right)")
+	flag.IntVar(&opts.PixelateGrid, "pixelate-grid", 4, "Number of blocks across the final pixelated frame")
+	flag.BoolVar(&opts.PixelateReverse, "pixelate-reverse", false, "Pixelate from coarse to fine instead of fine to coarse")
+	flag.StringVar(&opts.PixelateShape, "pixelate-shape", "square", "Pixelate mosaic shape: square, circle (dots) or hex (offset rows)")
+	flag.BoolVar(&opts.LoopSmooth, "loop-smooth", false, "Make progressive effects (zoom, pixelate, pinch, twirl, kenburns, morph) build up and return to the start so the loop is seamless")
+	flag.StringVar(&opts.Easing, "easing", "linear", "Easing curve for the 360 rotation and start:end parameter ranges: linear, ease-in, ease-out or ease-in-out")
+	flag.IntVar(&opts.Spins, "spins", 1, "Number of full turns the 360 rotation makes over the animation")
+	flag.IntVar(&opts.HueCycles, "hue-cycles", 1, "Number of full cycles hue makes through the hue range over the animation")
+	rampVar(&opts.PinchStrength, opts.Ramps, "pinch-strength", 1.0, "How strongly pinch pulls pixels toward the center at its peak")
+	rampVar(&opts.TwirlTurns, opts.Ramps, "twirl-turns", 1.0, "Full turns twirl has twisted the center by the last frame")
+	spotlightColor := flag.String("spotlight-color", "#ffff00", "Tint color of the spotlight as a hex value (#RRGGBB) or color name")
+	rampVar(&opts.SpotlightRadius, opts.Ramps, "spotlight-radius", 0.25, "Spotlight radius as a fraction of the smaller image dimension")
+	rampVar(&opts.GlowIntensity, opts.Ramps, "glow-intensity", 1.0, "Brightness of the glow halo around bright regions")
+	flag.IntVar(&opts.GlowRadius, "glow-radius", 4, "Blur radius of the glow halo in pixels")
+	rampVar(&opts.HeatAmplitude, opts.Ramps, "heat-amplitude", 3.0, "Maximum vertical displacement of the heat haze in pixels")
+	rampVar(&opts.KaleidoscopeZoom, opts.Ramps, "kaleidoscope-zoom", 1.0, "Magnification of the kaleidoscope pattern (above 1 zooms in, below 1 zooms out)")
+	flag.BoolVar(&opts.KaleidoscopeReflect, "kaleidoscope-reflect", true, "Mirror alternate kaleidoscope segments; false repeats segments by rotation only")
+	flag.IntVar(&opts.JitterAmount, "jitter-amount", 3, "Maximum offset of each color channel in rgbjitter, in pixels")
+	flag.IntVar(&opts.CMYKOffset, "cmyk-offset", 2, "Maximum misregistration of the cmyk cyan, magenta and yellow plates, in pixels")
+	flag.IntVar(&opts.ASCIICell, "ascii-cell", 8, "Size of each ascii character cell in pixels")
+	asciiRamp := flag.String("ascii-ramp", animoji.DefaultASCIIRamp, "Characters ascii draws, from the darkest cells to the brightest")
+	flag.Float64Var(&opts.JellyStiffness, "jelly-stiffness", 3, "Number of wobbles jelly makes over the loop; stiffer jelly wobbles faster")
+	flag.Float64Var(&opts.JellyDamping, "jelly-damping", 3, "How quickly the jelly wobble dies down; it comes to rest by the end of the loop (0 = it never does)")
+	kenBurnsFrom := flag.String("kenburns-from", "0.3,0.3", "Point the kenburns pan starts centered on, as x,y fractions of the image")
+	kenBurnsTo := flag.String("kenburns-to", "0.7,0.7", "Point the kenburns pan ends centered on, as x,y fractions of the image")
+	kenBurnsZoom := flag.String("kenburns-zoom", "1.2,1.6", "Zoom factor of kenburns on the first and last frames, as start,end")
+	rampVar(&opts.ReflectRipple, opts.Ramps, "reflect-ripple", 2.0, "Maximum sideways displacement of the reflect water ripples in pixels")
+	gradient := flag.String("gradient", "#1b0c3f,#c2185b,#ffd54f", "Comma-separated hex colors or color names gradientmap maps luminance onto, from dark to light")
+	flag.BoolVar(&opts.GradientCycle, "gradient-cycle", false, "Shift the gradientmap colors through the image's tones across the frames")
+	rampVar(&opts.BounceHeight, opts.Ramps, "bounce-height", 0.5, "Height bounce drops the image from, as a fraction of the image height")
+	hueRange := flag.String("hue-range", "330:30", "Band of hues recolor shifts, as low:high in degrees (wraps through 0 if low > high)")
+	channelOrder := flag.String("channel-order", "r,g,b,rg,gb,rb,rgb", "Comma-separated channel sets channel shows in turn, each some of r, g and b")
+	flag.IntVar(&opts.OutlineWidth, "outline-width", 3, "Thickness of the outline stroke in pixels")
+	outlineColor := flag.String("outline-color", "#ffffff", "Color of the outline stroke as a hex value (#RRGGBB) or color name")
+	flag.BoolVar(&opts.OutlineCycle, "outline-cycle", false, "Cycle the outline stroke through the full hue range instead of using -outline-color")
+	flag.BoolVar(&opts.VibesSmooth, "vibes-smooth", false, "Rotate the vibes tints smoothly around the hue wheel instead of switching colors every frame")
+	flag.IntVar(&opts.VibesFeather, "vibes-feather", 0, "Width in pixels of the band where neighboring vibes quarters blend into each other (0 = hard edges)")
+	flag.Float64Var(&opts.GrowFrom, "grow-from", 0, "Scale grow starts from, as a fraction of full size from 0 to 1")
+	flag.Float64Var(&opts.ZoomBlurStrength, "zoomblur-strength", 0.3, "Length of the zoomblur streaks on the last frame, as extra zoom of the farthest copy averaged in")
+	flag.IntVar(&opts.TileCount, "tile-count", 3, "Number of copies of the image across and down in tile")
+	flag.Int64Var(&opts.Seed, "seed", 0, "Seed for effects that use randomness (default: based on the current time)")
+	flag.IntVar(&opts.Jobs, "jobs", runtime.NumCPU(), "Maximum number of frames to render concurrently")
+	comment := flag.Bool("comment", false, "Embed a comment in the GIF describing how it was produced")
+	flag.BoolVar(&opts.Optimize, "optimize", false, "Encode only the changed region of each frame to reduce file size")
+	disposal := flag.String("disposal", "", "GIF frame disposal method: none, background or previous (default: background for transparent images)")
+
+	flag.Parse()
+
+	// Seed randomness from the clock unless a seed was given, so that
+	// repeated runs vary by default but can be reproduced with -seed
+	seedSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			seedSet = true
+		}
+	})
+	if !seedSet {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	if *listEffectsFlag {
+		listEffects(os.Stdout)
+		return
+	}
+
+	// Get subcommands from remaining arguments
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Error: at least one subcommand is required\n")
+		printUsage()
+		os.Exit(1)
+	}
+
+	subcommands, err := animoji.ExpandAliases(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid subcommand: %v\n", err)
+		os.Exit(1)
+	}
+	effects := make([]animoji.EffectSpec, len(subcommands))
+	for i, subcommand := range subcommands {
+		effect, err := animoji.ParseEffectSpec(subcommand)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid subcommand %s: %v\n", subcommand, err)
+			os.Exit(1)
+		}
+		if _, ok := animoji.LookupEffect(effect.Name); !ok {
+			fmt.Fprintf(os.Stderr, "Unknown subcommand: %s\n", effect.Name)
+			printUsage()
+			os.Exit(1)
+		}
+		effects[i] = effect
+	}
+
+	if opts.Frames <= 0 {
+		fmt.Fprintf(os.Stderr, "Number of frames must be positive\n")
+		os.Exit(1)
+	}
+
+	// A fractional rate takes precedence over the whole-number one
+	frameRate := float64(*rate)
+	if *rateFloat != 0 {
+		frameRate = *rateFloat
+	}
+
+	if frameRate <= 0 {
+		fmt.Fprintf(os.Stderr, "Frame rate must be positive\n")
+		os.Exit(1)
+	}
+
+	// GIF delays are whole 100ths of a second, so faster rates would need
+	// delays under one
+	if frameRate > 100 {
+		fmt.Fprintf(os.Stderr, "Frame rate must be at most 100 (GIF frame delays are in 100ths of a second)\n")
+		os.Exit(1)
+	}
+
+	if *speed <= 0 {
+		fmt.Fprintf(os.Stderr, "Speed must be positive\n")
+		os.Exit(1)
+	}
+
+	// Retime the animation by rendering fewer or more frames at the same
+	// rate. Effects spread their full cycle over however many frames there
+	// are, so slowing down renders genuine in-between frames rather than
+	// repeating them
+	if *speed != 1 {
+		opts.Frames = max(1, int(math.Round(float64(opts.Frames) / *speed)))
+	}
+
+	if *bpm < 0 {
+		fmt.Fprintf(os.Stderr, "BPM must be positive\n")
+		os.Exit(1)
+	}
+
+	if *beats <= 0 {
+		fmt.Fprintf(os.Stderr, "Beats must be positive\n")
+		os.Exit(1)
+	}
+
+	// Time the loop to the beat by choosing the rate that fits all of the
+	// frames into the given number of beats
+	if *bpm != 0 {
+		frameRate = float64(opts.Frames) / (60.0 / *bpm * *beats)
+		if frameRate > 100 {
+			fmt.Fprintf(os.Stderr, "%d frames in %g beats at %g BPM needs %.1f frames per second, over the maximum of 100 (use fewer -frames or more -beats)\n", opts.Frames, *beats, *bpm, frameRate)
+			os.Exit(1)
+		}
+	}
+
+	for i, effect := range effects {
+		if _, end := effect.Stage(opts.Frames); end > opts.Frames {
+			fmt.Fprintf(os.Stderr, "Frame range of %s ends at frame %d, after the last frame (%d)\n", subcommands[i], end, opts.Frames)
+			os.Exit(1)
+		}
+		if effect.Staged && effect.Start >= opts.Frames {
+			fmt.Fprintf(os.Stderr, "Frame range of %s starts after the last frame (%d)\n", subcommands[i], opts.Frames)
+			os.Exit(1)
+		}
+	}
+
+	if *preview < -1 || *preview >= opts.Frames {
+		fmt.Fprintf(os.Stderr, "Preview frame must be between 0 and %d\n", opts.Frames-1)
+		os.Exit(1)
+	}
+
+	for _, burst := range bursts {
+		name, every, err := parseBurst(burst)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid burst: %v\n", err)
+			os.Exit(1)
+		}
+		if !slices.ContainsFunc(effects, func(e animoji.EffectSpec) bool { return e.Name == name }) {
+			fmt.Fprintf(os.Stderr, "Invalid burst: %s is not one of the subcommands\n", name)
+			os.Exit(1)
+		}
+		if _, ok := opts.Bursts[name]; ok {
+			fmt.Fprintf(os.Stderr, "Invalid burst: -burst is given twice for %s\n", name)
+			os.Exit(1)
+		}
+		if opts.Bursts == nil {
+			opts.Bursts = map[string]int{}
+		}
+		opts.Bursts[name] = every
+	}
+
+	if *resize < 0 {
+		fmt.Fprintf(os.Stderr, "Resize width must be non-negative\n")
+		os.Exit(1)
+	}
+
+	var rawSize image.Point
+	if *raw != "" {
+		if animoji.IsURL(*inFile) {
+			fmt.Fprintf(os.Stderr, "-raw can't be used with an input URL\n")
+			os.Exit(1)
+		}
+		size, err := parseSize(*raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid raw size: %v\n", err)
+			os.Exit(1)
+		}
+		rawSize = size
+	}
+
+	var canvasSize image.Point
+	if *canvas != "" {
+		size, err := parseSize(*canvas)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid canvas size: %v\n", err)
+			os.Exit(1)
+		}
+		canvasSize = size
+	}
+
+	trimBackground := color.Color(color.Transparent)
+	if *trimColor != "" {
+		c, err := animoji.ParseHexColor(*trimColor)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid trim color: %v\n", err)
+			os.Exit(1)
+		}
+		trimBackground = c
+	}
+
+	if *trimTolerance < 0 || *trimTolerance > 255 {
+		fmt.Fprintf(os.Stderr, "Trim tolerance must be between 0 and 255\n")
+		os.Exit(1)
+	}
+
+	spotlight, err := animoji.ParseHexColor(*spotlightColor)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid spotlight color: %v\n", err)
+		os.Exit(1)
+	}
+	opts.SpotlightColor = spotlight
+
+	opts.ASCIIRamp, err = animoji.ParseASCIIRamp(*asciiRamp)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid ASCII ramp: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts.Center, err = parseFloatPair(*center)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid center: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts.KenBurnsFrom, err = parseFloatPair(*kenBurnsFrom)
+	if err == nil {
+		opts.KenBurnsTo, err = parseFloatPair(*kenBurnsTo)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid kenburns point: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts.KenBurnsZoom, err = parseFloatPair(*kenBurnsZoom)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid kenburns zoom: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts.GradientStops, err = parseGradient(*gradient)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid gradient: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts.HueRange, err = parseHueRange(*hueRange)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid hue range: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts.ChannelOrder, err = parseChannelOrder(*channelOrder)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid channel order: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts.OutlineColor, err = animoji.ParseHexColor(*outlineColor)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid outline color: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *maxBytes < 0 {
+		fmt.Fprintf(os.Stderr, "Max bytes must be non-negative\n")
+		os.Exit(1)
+	}
+
+	if *maxPixels < 0 {
+		fmt.Fprintf(os.Stderr, "Max pixels must be non-negative\n")
+		os.Exit(1)
+	}
+
+	// The best quality is bilinear sampling, supersampled for antialiased
+	// edges unless a higher factor was given
+	switch opts.Quality {
+	case "fast", "good":
+	case "best":
+		opts.Quality = "good"
+		opts.Supersample = max(opts.Supersample, 2)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown quality: %s (expected fast, good or best)\n", opts.Quality)
+		os.Exit(1)
+	}
+
+	opts.Disposal, err = animoji.ParseDisposal(*disposal)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	// Optimized frames draw over the previous frame, so it must be kept
+	if opts.Optimize {
+		if opts.Disposal != 0 && opts.Disposal != gif.DisposalNone {
+			fmt.Fprintf(os.Stderr, "-optimize requires -disposal none\n")
+			os.Exit(1)
+		}
+		opts.Disposal = gif.DisposalNone
+	}
+
+	// The package takes an alpha threshold of 0 to mean the default, so ask
+	// for 1 instead, which equally keeps every pixel that has any alpha
+	if opts.AlphaThreshold == 0 {
+		opts.AlphaThreshold = 1
+	}
+
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Load input image
+	var img image.Image
+	if rawSize != (image.Point{}) {
+		img, err = animoji.LoadRawImage(*inFile, rawSize)
+	} else if *inFile == "" {
+		img, err = animoji.LoadImageFromReader(os.Stdin, !*noAutorotate)
+	} else if animoji.IsURL(*inFile) {
+		img, err = animoji.LoadImageFromURL(*inFile, *timeout, !*noAutorotate)
+	} else if animoji.IsSVG(*inFile) {
+		img, err = animoji.LoadSVG(*inFile, svgWidth(*resize, *trim), *maxPixels)
+	} else {
+		img, err = animoji.LoadImage(*inFile, !*noAutorotate)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading image: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Normalize to 8-bit RGBA so effects and the palette see consistent
+	// colors regardless of the input's color model (16-bit, gray, paletted)
+	img = animoji.ToRGBA(img)
+
+	// Trim before resizing, so -resize sets the width of the subject itself.
+	// The mask and second image are cropped to the same area
+	var trimmed image.Rectangle
+	if *trim {
+		trimmed = animoji.TrimBounds(img, trimBackground, *trimTolerance)
+		img = animoji.CropImage(img, trimmed)
+	}
+
+	// Resize image if requested. SVGs are drawn at the right size already
+	if *resize > 0 && (svgWidth(*resize, *trim) == 0 || !animoji.IsSVG(*inFile)) {
+		img, err = animoji.ResizeImage(img, *resize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resizing image: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Load the second image, resized the same way as the first
+	if *inFile2 != "" {
+		opts.Image2, err = loadSecondImage(*inFile2, *timeout, !*noAutorotate, trimmed, *resize, img.Bounds().Size(), *maxPixels)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading second image: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Load the mask, resized the same way as the image
+	if *maskFile != "" {
+		opts.Mask, err = loadMask(*maskFile, trimmed, *resize, img.Bounds().Size())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading mask: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Load the fixed palette to quantize to, if any
+	if *paletteFile != "" {
+		opts.Palette, err = animoji.LoadPalette(*paletteFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading palette: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Rotation needs a square image, so pad a rectangular one if asked to;
+	// CheckEffects reports any image that still isn't square
+	if *autopad {
+		canvasSize, err = autopadCanvas(img.Bounds().Size(), canvasSize, effects)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Center everything on the canvas so effects have room to move the image
+	// around. The mask is extended with white so effects also apply to the
+	// uncovered area
+	if canvasSize != (image.Point{}) {
+		img = animoji.PlaceOnCanvas(img, canvasSize, color.Transparent)
+		if opts.Image2 != nil {
+			opts.Image2 = animoji.PlaceOnCanvas(opts.Image2, canvasSize, color.Transparent)
+		}
+		if opts.Mask != nil {
+			opts.Mask = animoji.ToGray(animoji.PlaceOnCanvas(opts.Mask, canvasSize, color.White))
+		}
+	}
+
+	// Try every effect once and report all of the problems if asked to,
+	// rather than stopping at the first
+	if *check {
+		errs := animoji.CheckPipeline(img, effects, opts)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		if len(errs) > 0 {
+			fmt.Fprintf(os.Stderr, "Check failed: %d of %d effects\n", len(errs), len(effects))
+			os.Exit(1)
+		}
+		fmt.Printf("Check passed: %s on a %dx%d image\n", strings.Join(subcommands, " "), img.Bounds().Dx(), img.Bounds().Dy())
+		return
+	}
+
+	// Catch effects that can't work with this image before rendering
+	if err := animoji.CheckEffects(img, effects, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Refuse to render more pixels than the budget allows
+	if err := checkPixels(img.Bounds(), opts, *maxPixels); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Use -resize to reduce the image size, fewer -frames, a lower -supersample or -oversample-frames, or raise -max-pixels (0 = unlimited)\n")
+		os.Exit(1)
+	}
+
+	// Create palette from source image
+	palette := animoji.BuildPalette(img, effects, opts)
+
+	if warning := paletteWarning(img, opts); warning != "" && !*quiet {
+		fmt.Fprint(os.Stderr, warning)
+	}
+
+	// Set the average delay between frames (in 100ths of a second); each
+	// frame's delay is rounded when it is written
+	opts.Delay = 100.0 / frameRate
+
+	// Clear each frame to the background by default when the palette
+	// contains transparent colors to avoid ghosting
+	if opts.Disposal == 0 && animoji.HasTransparency(palette) {
+		opts.Disposal = gif.DisposalBackground
+	}
+
+	// Build the comment extension text if requested
+	if *comment {
+		opts.Comment = buildComment(subcommands, opts.Seed)
+	}
+
+	// Write the image after each effect of one frame if requested
+	if *debugStages != "" {
+		if *debugFrame < 0 || *debugFrame >= opts.Frames {
+			fmt.Fprintf(os.Stderr, "Debug frame must be between 0 and %d\n", opts.Frames-1)
+			os.Exit(1)
+		}
+		if err := os.MkdirAll(*debugStages, 0o777); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating debug stages directory: %v\n", err)
+			os.Exit(1)
+		}
+		target := *debugFrame
+		if opts.Reverse {
+			target = opts.Frames - 1 - target
+		}
+		opts.OnStage = func(frameIdx, stage int, name string, img image.Image) {
+			if frameIdx != target {
+				return
+			}
+			filename := filepath.Join(*debugStages, fmt.Sprintf("stage_%d_%s.png", stage, name))
+			if err := writePNG(filename, img); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing debug stage: %v\n", err)
+			}
+		}
+	}
+
+	// Everything has been checked, so describe the render instead of doing
+	// it if requested
+	if *dryRun {
+		writeDryRun(os.Stdout, img, effects, palette, opts, outFiles)
+		return
+	}
+
+	// Write just the preview frame instead of the GIF if requested
+	if *preview >= 0 {
+		err = writeOutputs(outFiles, func(w io.Writer) error {
+			return animoji.WritePreview(w, img, effects, *preview, opts)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing preview: %v\n", err)
+			os.Exit(1)
+		}
+		if len(outFiles) > 0 {
+			fmt.Printf("Successfully created preview of frame %d: %s\n", *preview, strings.Join(outFiles, ", "))
+		}
+		return
+	}
+
+	// Encode the GIF once and write it to every output, counting the bytes
+	// for the manifest. If a byte budget was given, the GIF is shrunk until
+	// it fits
+	var written int64
+	fitImg, fit := img, opts
+	err = writeOutputs(outFiles, func(w io.Writer) error {
+		out := &countingWriter{w: w}
+		defer func() { written = out.n }()
+		if *maxBytes > 0 {
+			var data []byte
+			var err error
+			data, fitImg, fit, err = fitGIF(img, effects, opts, *maxBytes, *verbose)
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(data)
+			return err
+		}
+		return animoji.EncodeGIF(out, img, effects, palette, opts)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing GIF: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Describe the render in a sidecar file if requested
+	if *manifestFile != "" {
+		manifest := animoji.BuildManifest(fitImg.Bounds().Size(), effects, animoji.BuildPalette(fitImg, effects, fit), fit, written)
+		if err := animoji.WriteManifest(*manifestFile, manifest); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing manifest: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(outFiles) > 0 {
+		fmt.Printf("Successfully created animated GIF: %s\n", strings.Join(outFiles, ", "))
+	}
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: animoji [flags] <subcommand>\n")
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	fmt.Fprintf(os.Stderr, "  -in: Input image file or http(s) URL (PNG, JPEG, GIF, BMP, TIFF or WebP, or an .svg file, optional, defaults to stdin)\n")
+	fmt.Fprintf(os.Stderr, "  -in2: Second input image file or http(s) URL for morph, the same size as -in (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -raw: Read -in or stdin as raw RGBA pixels of size WxH instead of an encoded image (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -no-autorotate: Ignore the EXIF orientation of JPEG input (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -timeout: Timeout for fetching an input URL (default: 30s)\n")
+	fmt.Fprintf(os.Stderr, "  -out: Output GIF file, repeatable to write the same GIF to several files (optional, defaults to stdout)\n")
+	fmt.Fprintf(os.Stderr, "  -manifest: Also write a JSON file describing the render: size, frame delays, effects and their settings, colors and bytes (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -dry-run: Check the input, flags and effects and print what would be rendered, then exit without rendering (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -check: Load the input and apply each effect to one frame, reporting every effect that fails; exits 1 if any do (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -debug-stages: Directory to write the image after each effect to, as stage_<n>_<effect>.png, for debugging chains (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -debug-frame: Frame (0-based) whose stages -debug-stages writes (default: 0)\n")
+	fmt.Fprintf(os.Stderr, "  -preview: Render only frame N (0-based) and write it to -out as a PNG, to quickly try out settings (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -frames: Number of frames in the animation (default: 6)\n")
+	fmt.Fprintf(os.Stderr, "  -rate: Frame rate in frames per second, at most 100 (default: 3)\n")
+	fmt.Fprintf(os.Stderr, "  -rate-float: Fractional frame rate such as 7.5, overriding -rate (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -bpm: Tempo in beats per minute; sets the rate so the loop lasts -beats beats, overriding -rate and -rate-float (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -beats: Number of beats one loop lasts with -bpm, e.g. 4 for a bar or 0.5 for half a beat (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -speed: Playback speed, e.g. 2 for twice as fast or 0.5 for slow motion; changes the number of frames (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -center: Center of kaleidoscope, ripple, pinch and twirl as x,y fractions of the image (default: 0.5,0.5)\n")
+	fmt.Fprintf(os.Stderr, "  -crossfade: Frames over which a staged effect (name@start:end) blends into the stage that follows it (default: 0)\n")
+	fmt.Fprintf(os.Stderr, "  -sync: Keep looping effects in step across the whole animation instead of restarting each staged effect's cycle (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -burst: Apply an effect only in short bursts, as name:every:N for one starting every N frames, with its input unchanged in between; repeatable for several effects (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -burst-length: Number of frames each -burst lasts (default: 2)\n")
+	fmt.Fprintf(os.Stderr, "  -mask: Grayscale image the size of the input; effects apply fully in white areas, not at all in black (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -reverse: Reverse the order of frames (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -resize: Resize image to specified width, height scaled proportionally (0 = no resize)\n")
+	fmt.Fprintf(os.Stderr, "  -trim: Crop away a border of transparent (or -trim-color) pixels before resizing, so the subject fills the frame (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -trim-color: Border color removed by -trim, such as white (default: transparent)\n")
+	fmt.Fprintf(os.Stderr, "  -trim-tolerance: How far each channel may differ from the -trim color, 0-255, e.g. for JPEG noise (default: 0)\n")
+	fmt.Fprintf(os.Stderr, "  -autopad: Center a non-square image on a transparent square canvas so 360 can rotate it; a -canvas given with it must be square (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -canvas: Output size as WxH; the image is centered on a transparent canvas of this size that effects run on (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -ripple-mode: Ripple wave shape: radial (from center) or linear (default: radial)\n")
+	fmt.Fprintf(os.Stderr, "  -ripple-angle: Direction of linear ripple waves in degrees, 0 = left to right (default: 0)\n")
+	fmt.Fprintf(os.Stderr, "  -ripple-edge: What ripple shows beyond the image edges: clamp (stretch the edge pixels), wrap, reflect or transparent (default: clamp)\n")
+	fmt.Fprintf(os.Stderr, "  -pixelate-grid: Number of blocks across the final pixelated frame, at least 1 (default: 4)\n")
+	fmt.Fprintf(os.Stderr, "  -pixelate-reverse: Pixelate from coarse to fine, ending at the original image (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -pixelate-shape: Mosaic shape: square, circle (dots over the original) or hex (offset rows) (default: square)\n")
+	fmt.Fprintf(os.Stderr, "  -loop-smooth: Make zoom, pixelate, pinch, twirl, kenburns and morph build up and return to the start for a seamless loop (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -spins: Number of full turns the 360 rotation makes over the animation, at least 1 (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -hue-cycles: Number of full cycles hue makes through the hue range over the animation, at least 1 (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -easing: Easing curve for the 360 rotation and start:end parameter ranges: linear, ease-in, ease-out or ease-in-out (default: linear)\n")
+	fmt.Fprintf(os.Stderr, "  -pinch-strength: How strongly pinch pulls pixels toward the center at its peak (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -twirl-turns: Full turns twirl has twisted the center by the last frame (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -spotlight-color: Tint color of the spotlight as #RRGGBB, #RGB, #RRGGBBAA or a color name (default: #ffff00)\n")
+	fmt.Fprintf(os.Stderr, "  -spotlight-radius: Spotlight radius as a fraction of the smaller image dimension (default: 0.25)\n")
+	fmt.Fprintf(os.Stderr, "  -glow-intensity: Brightness of the glow halo around bright regions (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -glow-radius: Blur radius of the glow halo in pixels, at least 1 (default: 4)\n")
+	fmt.Fprintf(os.Stderr, "  -heat-amplitude: Maximum vertical displacement of the heat haze in pixels (default: 3)\n")
+	fmt.Fprintf(os.Stderr, "  -kaleidoscope-zoom: Magnification of the kaleidoscope pattern, above 1 zooms in and below 1 zooms out (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -kaleidoscope-reflect: Mirror alternate kaleidoscope segments for seamless symmetric joins;\n")
+	fmt.Fprintf(os.Stderr, "      with -kaleidoscope-reflect=false segments are only rotated, giving a pinwheel with hard seams (default: true)\n")
+	fmt.Fprintf(os.Stderr, "  -max-pixels: Maximum width x height x frames to render, 0 = unlimited (default: 200000000)\n")
+	fmt.Fprintf(os.Stderr, "  -colors: Maximum number of colors in the palette, 2-256; fewer colors give a smaller file (default: 256)\n")
+	fmt.Fprintf(os.Stderr, "  -palette: Quantize to a fixed palette, from a GIMP .gpl file or the distinct colors of an image, instead of the image's own colors (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -alpha-threshold: Pixels with alpha below this, from 0 to 255, become transparent in the GIF and the rest opaque (default: 128)\n")
+	fmt.Fprintf(os.Stderr, "  -dither: Dither colors missing from the palette: ordered (a fixed pattern that doesn't flicker between frames), floyd (Floyd-Steinberg) or none (default: none)\n")
+	fmt.Fprintf(os.Stderr, "  -max-bytes: Reduce colors, then size, then frames until the GIF fits in this many bytes (0 = no limit)\n")
+	fmt.Fprintf(os.Stderr, "  -verbose: Print details of processing, such as what -max-bytes had to reduce (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -quiet: Don't print warnings, such as when colors are dropped from the palette (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -quality: Sampling quality: fast (nearest neighbor), good (bilinear) or best (bilinear plus -supersample 2) (default: good)\n")
+	fmt.Fprintf(os.Stderr, "  -supersample: Render effects at N times the resolution and downscale for antialiasing, at N² times the time and memory (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -oversample-frames: Render N subframes per frame and average them to motion-blur fast movement (default: 1)\n")
+	fmt.Fprintf(os.Stderr, "  -jitter-amount: Maximum offset of each color channel in rgbjitter, in pixels (default: 3)\n")
+	fmt.Fprintf(os.Stderr, "  -cmyk-offset: Maximum misregistration of the cmyk cyan, magenta and yellow plates, in pixels (default: 2)\n")
+	fmt.Fprintf(os.Stderr, "  -ascii-cell: Size of each ascii character cell in pixels, at least 2 (default: 8)\n")
+	fmt.Fprintf(os.Stderr, "  -ascii-ramp: Characters ascii draws, from the darkest cells to the brightest (default: \"%s\")\n", animoji.DefaultASCIIRamp)
+	fmt.Fprintf(os.Stderr, "  -jelly-stiffness: Number of wobbles jelly makes over the loop; stiffer jelly wobbles faster (default: 3)\n")
+	fmt.Fprintf(os.Stderr, "  -jelly-damping: How quickly the jelly wobble dies down, coming to rest by the end of the loop; 0 = never (default: 3)\n")
+	fmt.Fprintf(os.Stderr, "  -kenburns-from: Point the kenburns pan starts centered on, as x,y fractions of the image (default: 0.3,0.3)\n")
+	fmt.Fprintf(os.Stderr, "  -kenburns-to: Point the kenburns pan ends centered on, as x,y fractions of the image (default: 0.7,0.7)\n")
+	fmt.Fprintf(os.Stderr, "  -kenburns-zoom: Zoom of kenburns on the first and last frames, as start,end, each at least 1 (default: 1.2,1.6)\n")
+	fmt.Fprintf(os.Stderr, "  -reflect-ripple: Maximum sideways displacement of the reflect water ripples in pixels (default: 2)\n")
+	fmt.Fprintf(os.Stderr, "  -gradient: Comma-separated colors (#RRGGBB or names) gradientmap maps dark to light tones onto (default: #1b0c3f,#c2185b,#ffd54f)\n")
+	fmt.Fprintf(os.Stderr, "  -gradient-cycle: Shift the gradientmap colors through the image's tones across the frames (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -bounce-height: Height bounce drops the image from, as a fraction of the image height (default: 0.5)\n")
+	fmt.Fprintf(os.Stderr, "  -hue-range: Band of hues recolor shifts, as low:high in degrees; 330:30 wraps through 0 to cover reds (default: 330:30)\n")
+	fmt.Fprintf(os.Stderr, "  -channel-order: Comma-separated channel sets channel shows in turn, each some of r, g and b (default: r,g,b,rg,gb,rb,rgb)\n")
+	fmt.Fprintf(os.Stderr, "  -outline-width: Thickness of the outline stroke in pixels, at least 1 (default: 3)\n")
+	fmt.Fprintf(os.Stderr, "  -outline-color: Color of the outline stroke (#RRGGBB or name) (default: #ffffff)\n")
+	fmt.Fprintf(os.Stderr, "  -outline-cycle: Cycle the outline stroke through the full hue range instead of using -outline-color (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -vibes-smooth: Rotate the vibes tints smoothly around the hue wheel instead of switching colors every frame (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -vibes-feather: Width in pixels of the band where neighboring vibes quarters blend into each other (default: 0, hard edges)\n")
+	fmt.Fprintf(os.Stderr, "  -grow-from: Scale grow starts from, as a fraction of full size from 0 to 1 (default: 0)\n")
+	fmt.Fprintf(os.Stderr, "  -zoomblur-strength: Length of the zoomblur streaks on the last frame, as extra zoom of the farthest copy, e.g. 0.3 for 30%% (default: 0.3)\n")
+	fmt.Fprintf(os.Stderr, "  -tile-count: Number of copies of the image across and down in tile, at least 1 (default: 3)\n")
+	fmt.Fprintf(os.Stderr, "  -seed: Seed for effects that use randomness; a fixed value, such as 0, gives identical output every run (default: based on the current time)\n")
+	fmt.Fprintf(os.Stderr, "  -jobs: Maximum number of frames to render concurrently (default: number of CPUs)\n")
+	fmt.Fprintf(os.Stderr, "  -list-effects: List the effects with their descriptions and the flags that tune them, and the aliases, then exit (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -comment: Embed a GIF comment with the tool version, effects, seed and timestamp (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -optimize: Encode only the changed region of each frame to reduce file size (optional)\n")
+	fmt.Fprintf(os.Stderr, "  -disposal: Frame disposal method: none, background or previous (default: background for transparent images)\n")
+	fmt.Fprintf(os.Stderr, "\nSubcommands:\n")
+	for _, info := range animoji.Effects {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", info.Name, info.Description)
+	}
+	fmt.Fprintf(os.Stderr, "\nAliases (shorthand for chains of subcommands):\n")
+	for _, name := range aliasNames() {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", name, strings.Join(animoji.Aliases[name], " "))
+	}
+	fmt.Fprintf(os.Stderr, "\nExample:\n")
+	fmt.Fprintf(os.Stderr, "  animoji -in image.png -out output.gif -resize 128 360\n")
+	fmt.Fprintf(os.Stderr, "  animoji -in image.png -out output.gif -resize 128 ripple tint-rgb zoom\n")
+	fmt.Fprintf(os.Stderr, "  animoji -in image.png -out output.gif -resize 128 ripple~0.3 hue\n")
+	fmt.Fprintf(os.Stderr, "\nNote: Multiple subcommands can be chained together. Effects are applied sequentially to each frame.\n")
+	fmt.Fprintf(os.Stderr, "Append +phase (0-1) to a subcommand to shift a looping effect through its cycle, e.g. ripple+0.25 for a quarter cycle ahead.\n")
+	fmt.Fprintf(os.Stderr, "Append ~mix (0-1) to a subcommand to blend that effect with its input, e.g. ripple~0.3 for 30%% ripple.\n")
+	fmt.Fprintf(os.Stderr, "Append @start:end to apply an effect only from frame start to end-1, e.g. ripple@0:6 zoom@6:12.\n")
+	fmt.Fprintf(os.Stderr, "Effect strength flags (-pinch-strength, -twirl-turns, -spotlight-radius, -glow-intensity, -heat-amplitude,\n")
+	fmt.Fprintf(os.Stderr, "-kaleidoscope-zoom, -reflect-ripple, -bounce-height, -ripple-angle) also accept a start:end range animated\n")
+	fmt.Fprintf(os.Stderr, "across the frames, e.g. -glow-intensity 0:2.\n")
+}
+
+// writeDryRun describes the animation that would be rendered from img, for
+// -dry-run: its size and timing, each effect with the settings of the flags
+// it uses, the palette and where the GIF would be written.
+func writeDryRun(w io.Writer, img image.Image, effects []animoji.EffectSpec, palette color.Palette, opts animoji.Options, outFiles []string) {
+	m := animoji.BuildManifest(img.Bounds().Size(), effects, palette, opts, 0)
+	fmt.Fprintf(w, "Size: %dx%d\n", m.Width, m.Height)
+	if opts.Supersample > 1 {
+		fmt.Fprintf(w, "Rendered at: %dx%d (supersample %d)\n", m.Width*opts.Supersample, m.Height*opts.Supersample, opts.Supersample)
+	}
+	fmt.Fprintf(w, "Frames: %d, %.2f seconds per loop\n", m.Frames, m.Duration)
+	if opts.Oversample > 1 {
+		fmt.Fprintf(w, "Subframes: %d per frame, %d rendered\n", opts.Oversample, m.Frames*opts.Oversample)
+	}
+	fmt.Fprintf(w, "Effects:\n")
+	for i, e := range m.Effects {
+		fmt.Fprintf(w, "  %d. %s, frames %d to %d, mix %g\n", i+1, e.Name, e.Start, e.End-1, e.Mix)
+		info, _ := animoji.LookupEffect(e.Name)
+		for _, param := range info.Params {
+			if value, ok := e.Params[param.Flag]; ok {
+				fmt.Fprintf(w, "     -%s %s\n", param.Flag, value)
+			}
+		}
+	}
+	fmt.Fprintf(w, "Palette: %d colors\n", m.Colors)
+	fmt.Fprintf(w, "Seed: %d\n", m.Seed)
+	if len(outFiles) == 0 {
+		fmt.Fprintf(w, "Output: stdout\n")
+	} else {
+		fmt.Fprintf(w, "Output: %s\n", strings.Join(outFiles, ", "))
+	}
+}
+
+// loadSecondImage loads the second input image from a file or URL, and
+// prepares it like the first: converted to RGBA, cropped to crop if it isn't
+// empty and resized to the given width if resize is positive. The result must
+// be the given size. An SVG is rasterized at no more than maxPixels pixels.
+func loadSecondImage(path string, timeout time.Duration, autorotate bool, crop image.Rectangle, resize int, size image.Point, maxPixels int64) (image.Image, error) {
+	var img image.Image
+	var err error
+	if animoji.IsURL(path) {
+		img, err = animoji.LoadImageFromURL(path, timeout, autorotate)
+	} else if animoji.IsSVG(path) {
+		img, err = animoji.LoadSVG(path, svgWidth(resize, !crop.Empty()), maxPixels)
+	} else {
+		img, err = animoji.LoadImage(path, autorotate)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img = animoji.ToRGBA(img)
+	if !crop.Empty() {
+		img = animoji.CropImage(img, crop)
+	}
+	if resize > 0 && (svgWidth(resize, !crop.Empty()) == 0 || !animoji.IsSVG(path)) {
+		img, err = animoji.ResizeImage(img, resize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if img.Bounds().Size() != size {
+		return nil, fmt.Errorf("second image is %dx%d but the first is %dx%d",
+			img.Bounds().Dx(), img.Bounds().Dy(), size.X, size.Y)
+	}
+	return img, nil
+}
+
+// loadMask loads a mask image, crops it to crop if it isn't empty and resizes
+// it to the given width if resize is positive (as done for the input image)
+// and converts it to grayscale. The result must be the given size.
+func loadMask(filename string, crop image.Rectangle, resize int, size image.Point) (*image.Gray, error) {
+	mask, err := animoji.LoadImage(filename, true)
+	if err != nil {
+		return nil, err
+	}
+	if !crop.Empty() {
+		mask = animoji.CropImage(mask, crop)
+	}
+	if resize > 0 {
+		mask, err = animoji.ResizeImage(mask, resize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if mask.Bounds().Size() != size {
+		return nil, fmt.Errorf("mask is %dx%d but the image is %dx%d",
+			mask.Bounds().Dx(), mask.Bounds().Dy(), size.X, size.Y)
+	}
+	return animoji.ToGray(mask), nil
+}
+
+// svgWidth returns the width to rasterize an SVG input at: the -resize
+// width, or 0 for the drawing's own size when there is no -resize or when
+// -trim crops the image before it is resized.
+func svgWidth(resize int, trim bool) int {
+	if trim {
+		return 0
+	}
+	return resize
+}
+
+// autopadCanvas returns the canvas size -autopad gives an image of the given
+// size: a square as large as its longer side when 360 rotates it, or else
+// canvas unchanged (the zero size for no canvas). An explicit canvas is never
+// resized, so with 360 it is an error unless it is already square.
+func autopadCanvas(size, canvas image.Point, effects []animoji.EffectSpec) (image.Point, error) {
+	if !slices.ContainsFunc(effects, func(e animoji.EffectSpec) bool { return e.Name == "360" }) {
+		return canvas, nil
+	}
+	if canvas != (image.Point{}) {
+		if canvas.X != canvas.Y {
+			return canvas, fmt.Errorf("-autopad can't make the %dx%d -canvas square; give a square -canvas or leave out -autopad", canvas.X, canvas.Y)
+		}
+		return canvas, nil
+	}
+	if size.X == size.Y {
+		return canvas, nil
+	}
+	side := max(size.X, size.Y)
+	return image.Pt(side, side), nil
+}
+
+// checkPixels returns an error if animating an image of the given bounds
+// renders more than limit pixels, counting every supersampled pixel of every
+// subframe. A limit of 0 allows any number.
+func checkPixels(bounds image.Rectangle, opts animoji.Options, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	supersample, oversample := int64(max(opts.Supersample, 1)), int64(max(opts.Oversample, 1))
+	total := int64(bounds.Dx()) * int64(bounds.Dy()) * int64(opts.Frames) * supersample * supersample * oversample
+	if total > limit {
+		return fmt.Errorf("image is too large to animate: %dx%d with %d frames × %d² supersampling × %d subframes is %d pixels, over the limit of %d",
+			bounds.Dx(), bounds.Dy(), opts.Frames, supersample, oversample, total, limit)
+	}
+	return nil
+}
+
+// paletteWarning returns the warning to print when the image has more colors
+// than the palette holds, since photos can then look unexpectedly
+// posterized, or "" if all its colors fit.
+func paletteWarning(img image.Image, opts animoji.Options) string {
+	if opts.Palette != nil {
+		return ""
+	}
+	if _, truncated := animoji.SamplePalette(img, opts.Colors); !truncated {
+		return ""
+	}
+	warning := fmt.Sprintf("Warning: the image has more than %d colors, so only the first %d found are kept in the GIF palette\n", opts.Colors, opts.Colors)
+	if opts.Dither == "none" {
+		return warning + "Colors may look posterized; -dither ordered smooths them (use -quiet to hide this warning)\n"
+	}
+	return warning + "Colors may look posterized (use -quiet to hide this warning)\n"
+}
+
+// parseBurst parses a -burst spec of the form name:every:N, returning the
+// effect name and N, the number of frames from the start of one burst to
+// the start of the next.
+func parseBurst(s string) (string, int, error) {
+	name, rest, _ := strings.Cut(s, ":")
+	nStr, ok := strings.CutPrefix(rest, "every:")
+	if name == "" || !ok {
+		return "", 0, fmt.Errorf("expected name:every:N, got '%s'", s)
+	}
+	if _, ok := animoji.LookupEffect(name); !ok {
+		return "", 0, fmt.Errorf("unknown effect %s", name)
+	}
+	n, err := strconv.Atoi(nStr)
+	if err != nil || n < 1 {
+		return "", 0, fmt.Errorf("burst interval must be a positive integer (got '%s')", nStr)
+	}
+	return name, n, nil
+}
+
+// parseSize parses a size in WxH form, such as 128x64.
+func parseSize(s string) (image.Point, error) {
+	w, h, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return image.Point{}, fmt.Errorf("expected WxH, got '%s'", s)
+	}
+	width, err := strconv.Atoi(strings.TrimSpace(w))
+	if err != nil || width <= 0 {
+		return image.Point{}, fmt.Errorf("invalid width '%s'", w)
+	}
+	height, err := strconv.Atoi(strings.TrimSpace(h))
+	if err != nil || height <= 0 {
+		return image.Point{}, fmt.Errorf("invalid height '%s'", h)
+	}
+	return image.Pt(width, height), nil
+}
+
+// stringList is a flag.Value collecting every value of a repeated flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// rampValue is a flag.Value for a float parameter that also accepts a
+// start:end range, such as 0:2, to animate the parameter across the frames.
+// The parameter is set to the start value and the range is recorded in
+// ramps under the flag's name.
+type rampValue struct {
+	value *float64
+	ramps map[string][2]float64
+	name  string
+}
+
+// rampVar defines a float flag like flag.Float64Var that also accepts a
+// start:end range.
+func rampVar(p *float64, ramps map[string][2]float64, name string, value float64, usage string) {
+	*p = value
+	flag.Var(rampValue{p, ramps, name}, name, usage)
+}
+
+func (v rampValue) String() string {
+	if v.value == nil {
+		return "0"
+	}
+	if ramp, ok := v.ramps[v.name]; ok {
+		return fmt.Sprintf("%g:%g", ramp[0], ramp[1])
+	}
+	return strconv.FormatFloat(*v.value, 'g', -1, 64)
+}
+
+func (v rampValue) Set(s string) error {
+	first, second, ranged := strings.Cut(s, ":")
+	start, err := strconv.ParseFloat(strings.TrimSpace(first), 64)
+	if err != nil {
+		return fmt.Errorf("invalid number '%s'", first)
+	}
+	*v.value = start
+	if !ranged {
+		delete(v.ramps, v.name)
+		return nil
+	}
+
+	end, err := strconv.ParseFloat(strings.TrimSpace(second), 64)
+	if err != nil {
+		return fmt.Errorf("invalid number '%s'", second)
+	}
+	v.ramps[v.name] = [2]float64{start, end}
+	return nil
+}
+
+// parseFloatPair parses a pair of numbers written as "a,b".
+func parseFloatPair(s string) ([2]float64, error) {
+	first, second, ok := strings.Cut(s, ",")
+	if !ok {
+		return [2]float64{}, fmt.Errorf("expected two comma-separated numbers, got '%s'", s)
+	}
+	a, err := strconv.ParseFloat(strings.TrimSpace(first), 64)
+	if err != nil {
+		return [2]float64{}, fmt.Errorf("invalid number '%s'", first)
+	}
+	b, err := strconv.ParseFloat(strings.TrimSpace(second), 64)
+	if err != nil {
+		return [2]float64{}, fmt.Errorf("invalid number '%s'", second)
+	}
+	return [2]float64{a, b}, nil
+}
+
+// parseHueRange parses a band of hues in low:high form, in degrees from 0
+// to 360.
+func parseHueRange(s string) ([2]float64, error) {
+	first, second, ok := strings.Cut(s, ":")
+	if !ok {
+		return [2]float64{}, fmt.Errorf("expected low:high in degrees, got '%s'", s)
+	}
+	var hues [2]float64
+	for i, part := range []string{first, second} {
+		hue, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || hue < 0 || hue > 360 {
+			return [2]float64{}, fmt.Errorf("invalid hue '%s' (expected 0 to 360)", part)
+		}
+		hues[i] = hue
+	}
+	return hues, nil
+}
+
+// parseChannelOrder parses a comma-separated list of channel sets such as
+// "r,gb,rgb", each made of the letters r, g and b.
+func parseChannelOrder(s string) ([][3]bool, error) {
+	var order [][3]bool
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty channel set in '%s'", s)
+		}
+		var channels [3]bool
+		for _, letter := range strings.ToLower(part) {
+			i := strings.IndexRune("rgb", letter)
+			if i < 0 || channels[i] {
+				return nil, fmt.Errorf("invalid channel set '%s' (expected some of r, g and b, each at most once)", part)
+			}
+			channels[i] = true
+		}
+		order = append(order, channels)
+	}
+	return order, nil
+}
+
+// parseGradient parses a comma-separated list of at least two colors.
+func parseGradient(s string) ([]color.RGBA, error) {
+	var stops []color.RGBA
+	for _, part := range strings.Split(s, ",") {
+		stop, err := animoji.ParseHexColor(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		stops = append(stops, stop)
+	}
+	if len(stops) < 2 {
+		return nil, fmt.Errorf("a gradient needs at least two colors")
+	}
+	return stops, nil
+}
+
+// writeOutputs calls write once with a writer that writes to every one of
+// the files at the same time, or to stdout if there are none. A file named
+// more than once, such as a.gif and ./a.gif, is written once. If write fails,
+// the files are removed so no partial output is left behind.
+func writeOutputs(filenames []string, write func(w io.Writer) error) error {
+	if len(filenames) == 0 {
+		return write(os.Stdout)
+	}
+
+	// Open each file once, however many ways it is named
+	var unique []string
+	for _, filename := range filenames {
+		if filename = filepath.Clean(filename); !slices.Contains(unique, filename) {
+			unique = append(unique, filename)
+		}
+	}
+	filenames = unique
+
+	var files []*os.File
+	removeAll := func() {
+		for _, file := range files {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}
+
+	writers := make([]io.Writer, 0, len(filenames))
+	for _, filename := range filenames {
+		file, err := os.Create(filename)
+		if err != nil {
+			removeAll()
+			return err
+		}
+		files = append(files, file)
+		writers = append(writers, file)
+	}
+
+	if err := write(io.MultiWriter(writers...)); err != nil {
+		removeAll()
+		return err
+	}
+
+	var closeErr error
+	for _, file := range files {
+		if err := file.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+// writePNG encodes img as a PNG file.
+func writePNG(filename string, img image.Image) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// fitGIF encodes the animation into memory, retrying with fewer colors, then
+// smaller dimensions, then fewer frames until the output is no larger than
+// maxBytes. It returns the GIF along with the image and options of the
+// attempt that fit, or an error if even the smallest attempt is too large.
+func fitGIF(img image.Image, effects []animoji.EffectSpec, opts animoji.Options, maxBytes int64, verbose bool) ([]byte, image.Image, animoji.Options, error) {
+	// Limits on how far each setting is reduced
+	minColors := min(16, opts.Colors)
+	if opts.Palette != nil {
+		// A fixed palette is kept whole
+		minColors = opts.Colors
+	}
+	minWidth := 16
+	minFrames := min(2, opts.Frames)
+
+	width := img.Bounds().Dx()
+	attempt := opts
+	attemptImg := img
+	for {
+		var buf bytes.Buffer
+		palette := animoji.BuildPalette(attemptImg, effects, attempt)
+		if err := animoji.EncodeGIF(&buf, attemptImg, effects, palette, attempt); err != nil {
+			return nil, nil, opts, err
+		}
+
+		size := attemptImg.Bounds().Size()
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Encoded %dx%d, %d colors, %d frames: %d bytes\n",
+				size.X, size.Y, attempt.Colors, attempt.Frames, buf.Len())
+		}
+
+		if int64(buf.Len()) <= maxBytes {
+			if verbose {
+				reportFit(img, opts, attemptImg, attempt)
+			}
+			return buf.Bytes(), attemptImg, attempt, nil
+		}
+
+		// Give up colors first, then size, then smoothness of motion
+		switch {
+		case attempt.Colors > minColors:
+			attempt.Colors = max(minColors, attempt.Colors/2)
+		case size.X*3/4 >= minWidth:
+			width = width * 3 / 4
+			resized, err := animoji.ResizeImage(img, width)
+			if err != nil {
+				return nil, nil, opts, err
+			}
+			attemptImg = resized
+			if opts.Mask != nil {
+				resizedMask, err := animoji.ResizeImage(opts.Mask, width)
+				if err != nil {
+					return nil, nil, opts, err
+				}
+				attempt.Mask = animoji.ToGray(resizedMask)
+			}
+			if opts.Image2 != nil {
+				attempt.Image2, err = animoji.ResizeImage(opts.Image2, width)
+				if err != nil {
+					return nil, nil, opts, err
+				}
+			}
+		case attempt.Frames > minFrames:
+			// Lengthen the delay so the animation keeps its duration
+			attempt.Frames = max(minFrames, attempt.Frames/2)
+			attempt.Delay = opts.Delay * float64(opts.Frames) / float64(attempt.Frames)
+		default:
+			return nil, nil, opts, fmt.Errorf("cannot fit the GIF in %d bytes (smallest attempt was %d bytes)", maxBytes, buf.Len())
+		}
+	}
+}
+
+// reportFit prints the settings that fitGIF had to reduce to stderr.
+func reportFit(img image.Image, opts animoji.Options, fitImg image.Image, fit animoji.Options) {
+	var changes []string
+	if fit.Colors != opts.Colors {
+		changes = append(changes, fmt.Sprintf("colors %d -> %d", opts.Colors, fit.Colors))
+	}
+	if size, fitSize := img.Bounds().Size(), fitImg.Bounds().Size(); fitSize != size {
+		changes = append(changes, fmt.Sprintf("size %dx%d -> %dx%d", size.X, size.Y, fitSize.X, fitSize.Y))
+	}
+	if fit.Frames != opts.Frames {
+		changes = append(changes, fmt.Sprintf("frames %d -> %d", opts.Frames, fit.Frames))
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintf(os.Stderr, "GIF fits without reductions\n")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Reduced to fit: %s\n", strings.Join(changes, ", "))
+}
+
+func buildComment(subcommands []string, seed int64) string {
+	return fmt.Sprintf("animoji %s; effects: %s; seed: %d; created: %s",
+		animoji.Version, strings.Join(subcommands, " "), seed, time.Now().UTC().Format(time.RFC3339))
+}
+
+// countingWriter passes writes through to w, counting the bytes written.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// listEffects writes every effect with its description and the flags that
+// tune it, then the aliases and what they expand to, for -list-effects.
+func listEffects(w io.Writer) {
+	for _, info := range animoji.Effects {
+		fmt.Fprintf(w, "%s: %s\n", info.Name, info.Description)
+		for _, param := range info.Params {
+			fmt.Fprintf(w, "  -%s (default: %s): %s\n", param.Flag, param.Default, param.Range)
+		}
+	}
+	fmt.Fprintf(w, "\nAliases:\n")
+	for _, name := range aliasNames() {
+		fmt.Fprintf(w, "%s: %s\n", name, strings.Join(animoji.Aliases[name], " "))
+	}
+}
+
+// aliasNames returns the names of the aliases in alphabetical order.
+func aliasNames() []string {
+	names := make([]string, 0, len(animoji.Aliases))
+	for name := range animoji.Aliases {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
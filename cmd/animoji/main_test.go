@@ -0,0 +1,169 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"animoji"
+)
+
+func TestRampValue(t *testing.T) {
+	var value float64
+	ramps := map[string][2]float64{}
+	v := rampValue{&value, ramps, "glow-intensity"}
+
+	for _, tt := range []struct {
+		in     string
+		value  float64
+		ramp   [2]float64
+		ranged bool
+		str    string
+	}{
+		{"2", 2, [2]float64{}, false, "2"},
+		{"0:2", 0, [2]float64{0, 2}, true, "0:2"},
+		{" 1.5 : -3 ", 1.5, [2]float64{1.5, -3}, true, "1.5:-3"},
+		{"4", 4, [2]float64{}, false, "4"}, // A single value replaces a range
+	} {
+		if err := v.Set(tt.in); err != nil {
+			t.Errorf("Set(%q): %v", tt.in, err)
+			continue
+		}
+		ramp, ranged := ramps["glow-intensity"]
+		if value != tt.value || ranged != tt.ranged || ramp != tt.ramp {
+			t.Errorf("Set(%q) gave %g and range %v (%t), want %g and %v (%t)", tt.in, value, ramp, ranged, tt.value, tt.ramp, tt.ranged)
+		}
+		if got := v.String(); got != tt.str {
+			t.Errorf("after Set(%q), String() = %q, want %q", tt.in, got, tt.str)
+		}
+	}
+
+	for _, in := range []string{"", "a", "1:", ":2", "1:b", "1:2:3"} {
+		if err := v.Set(in); err == nil {
+			t.Errorf("Set(%q): expected an error", in)
+		}
+	}
+}
+
+func TestParseBurst(t *testing.T) {
+	name, every, err := parseBurst("rgbjitter:every:10")
+	if err != nil || name != "rgbjitter" || every != 10 {
+		t.Errorf("parseBurst(rgbjitter:every:10) = %s, %d, %v", name, every, err)
+	}
+
+	for _, in := range []string{"", "every:10", ":every:10", "rgbjitter", "rgbjitter:10", "rgbjitter:every:0", "rgbjitter:every:x", "nothing:every:3"} {
+		if _, _, err := parseBurst(in); err == nil {
+			t.Errorf("parseBurst(%q): expected an error", in)
+		}
+	}
+}
+
+func TestPaletteWarning(t *testing.T) {
+	// 64 colors, in 4x4 blocks so that palette sampling finds them all
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := range 32 {
+		for x := range 32 {
+			img.Set(x, y, color.RGBA{uint8(x / 4 * 32), uint8(y / 4 * 32), 0, 255})
+		}
+	}
+
+	for _, tt := range []struct {
+		opts   animoji.Options
+		warn   bool
+		dither bool // Whether the warning suggests -dither
+	}{
+		{animoji.Options{Colors: 256, Dither: "none"}, false, false},
+		{animoji.Options{Colors: 64, Dither: "none"}, false, false},
+		{animoji.Options{Colors: 16, Dither: "none"}, true, true},
+		{animoji.Options{Colors: 16, Dither: "ordered"}, true, false},
+		{animoji.Options{Colors: 16, Dither: "none", Palette: color.Palette{color.Black}}, false, false},
+	} {
+		warning := paletteWarning(img, tt.opts)
+		if warn := warning != ""; warn != tt.warn {
+			t.Errorf("colors %d, dither %s: warning %q, want one: %t", tt.opts.Colors, tt.opts.Dither, warning, tt.warn)
+		}
+		if dither := strings.Contains(warning, "-dither"); dither != tt.dither {
+			t.Errorf("colors %d, dither %s: warning %q, want -dither suggested: %t", tt.opts.Colors, tt.opts.Dither, warning, tt.dither)
+		}
+	}
+}
+
+func TestCheckPixels(t *testing.T) {
+	bounds := image.Rect(0, 0, 10, 10)
+	opts := animoji.Options{Frames: 10, Supersample: 2, Oversample: 3}
+	if err := checkPixels(bounds, opts, 12000); err != nil {
+		t.Errorf("12000 pixels within the limit: %v", err)
+	}
+	if err := checkPixels(bounds, opts, 0); err != nil {
+		t.Errorf("no limit: %v", err)
+	}
+
+	err := checkPixels(bounds, opts, 11999)
+	if err == nil {
+		t.Fatalf("12000 pixels over a limit of 11999: expected an error")
+	}
+	for _, want := range []string{"10x10", "10 frames", "2² supersampling", "3 subframes", "12000 pixels"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %q", err, want)
+		}
+	}
+}
+
+func TestAutopadCanvas(t *testing.T) {
+	rotate := []animoji.EffectSpec{{Name: "hue"}, {Name: "360"}}
+	for _, tt := range []struct {
+		size, canvas image.Point
+		effects      []animoji.EffectSpec
+		want         image.Point
+		err          bool
+	}{
+		{image.Pt(40, 30), image.Point{}, rotate, image.Pt(40, 40), false},
+		{image.Pt(30, 40), image.Point{}, rotate, image.Pt(40, 40), false},
+		{image.Pt(40, 40), image.Point{}, rotate, image.Point{}, false},
+		{image.Pt(40, 30), image.Point{}, []animoji.EffectSpec{{Name: "hue"}}, image.Point{}, false},
+		{image.Pt(40, 30), image.Pt(50, 50), rotate, image.Pt(50, 50), false},
+		{image.Pt(40, 30), image.Pt(50, 20), rotate, image.Point{}, true},
+		{image.Pt(40, 30), image.Pt(50, 20), []animoji.EffectSpec{{Name: "hue"}}, image.Pt(50, 20), false},
+	} {
+		got, err := autopadCanvas(tt.size, tt.canvas, tt.effects)
+		if tt.err {
+			if err == nil {
+				t.Errorf("size %v, canvas %v: expected an error", tt.size, tt.canvas)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("size %v, canvas %v: got %v (%v), want %v", tt.size, tt.canvas, got, err, tt.want)
+		}
+	}
+}
+
+func TestWriteOutputsDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	calls := 0
+	err := writeOutputs([]string{"a.gif", "./a.gif", "sub/../a.gif", "b.gif"}, func(w io.Writer) error {
+		calls++
+		_, err := io.WriteString(w, "GIF89a")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("writeOutputs: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("write called %d times, want 1", calls)
+	}
+	for _, name := range []string{"a.gif", "b.gif"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "GIF89a" {
+			t.Errorf("%s holds %q, want one copy of the output", name, data)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package animoji
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// EffectInfo describes an effect that can be named as a subcommand, for
+// usage text, validation and for building interfaces around the package.
+type EffectInfo struct {
+	Name        string        // Subcommand name, as passed to GenerateFrames and WriteGIF
+	Description string        // One-line description of the animation
+	Params      []EffectParam // Command line flags that tune the effect
+}
+
+// EffectParam describes a command line flag that tunes an effect.
+type EffectParam struct {
+	Flag    string // Flag name, without the leading dash
+	Default string // Default value, as it would be given on the command line
+	Range   string // Accepted values
+}
+
+// Effects lists every effect, in the order they are documented. Flags shared
+// by several effects appear under each of them.
+var Effects = []EffectInfo{
+	{"360", "Rotate image 360 degrees clockwise", []EffectParam{
+		{"easing", "linear", "linear, ease-in, ease-out or ease-in-out"},
+		{"spins", "1", "whole number, at least 1"},
+	}},
+	{"hue", "Cycle through hue range", []EffectParam{
+		{"hue-cycles", "1", "whole number, at least 1"},
+	}},
+	{"zoom", "Zoom image in (up to 6x)", []EffectParam{
+		{"loop-smooth", "false", "true or false"},
+	}},
+	{"pixelate", "Gradually pixelate image to a grid (4x4 by default, see -pixelate-grid)", []EffectParam{
+		{"pixelate-grid", "4", "whole number, at least 1"},
+		{"pixelate-reverse", "false", "true or false"},
+		{"pixelate-shape", "square", "square, circle or hex"},
+		{"loop-smooth", "false", "true or false"},
+	}},
+	{"tint-rgb", "Apply RGB tint layer with 50% opacity, cycling through colors", nil},
+	{"vibes", "Apply rotating color tints to image quarters (violet, yellow, green, blue)", []EffectParam{
+		{"vibes-smooth", "false", "true or false"},
+		{"vibes-feather", "0", "pixels, 0 or more"},
+	}},
+	{"kaleidoscope", "Create kaleidoscope effect with rotating mirrored sections", []EffectParam{
+		{"center", "0.5,0.5", "x,y fractions from 0 to 1"},
+		{"kaleidoscope-zoom", "1", "above 0, or a start:end range"},
+		{"kaleidoscope-reflect", "true", "true or false"},
+	}},
+	{"ripple", "Apply ripple wave distortion emanating from center", []EffectParam{
+		{"center", "0.5,0.5", "x,y fractions from 0 to 1"},
+		{"ripple-mode", "radial", "radial or linear"},
+		{"ripple-angle", "0", "degrees, or a start:end range"},
+		{"ripple-edge", "clamp", "clamp, wrap, reflect or transparent"},
+	}},
+	{"spotlight", "Sweep a tinted circular highlight around the image", []EffectParam{
+		{"spotlight-color", "#ffff00", "hex color or color name"},
+		{"spotlight-radius", "0.25", "above 0, or a start:end range"},
+	}},
+	{"pinch", "Progressively squeeze the image toward the center", []EffectParam{
+		{"center", "0.5,0.5", "x,y fractions from 0 to 1"},
+		{"pinch-strength", "1", "0 or more, or a start:end range"},
+		{"loop-smooth", "false", "true or false"},
+	}},
+	{"twirl", "Progressively twist the image around its center, winding up over the frames", []EffectParam{
+		{"center", "0.5,0.5", "x,y fractions from 0 to 1"},
+		{"twirl-turns", "1", "turns, or a start:end range"},
+		{"loop-smooth", "false", "true or false"},
+	}},
+	{"glow", "Add a blurred neon halo around bright regions, cycling through hues", []EffectParam{
+		{"glow-intensity", "1", "0 or more, or a start:end range"},
+		{"glow-radius", "4", "pixels, at least 1"},
+	}},
+	{"heat", "Shimmer the image like heat haze, strongest at the bottom", []EffectParam{
+		{"heat-amplitude", "3", "pixels, 0 or more, or a start:end range"},
+	}},
+	{"kenburns", "Slowly zoom while panning across the image", []EffectParam{
+		{"kenburns-from", "0.3,0.3", "x,y fractions from 0 to 1"},
+		{"kenburns-to", "0.7,0.7", "x,y fractions from 0 to 1"},
+		{"kenburns-zoom", "1.2,1.6", "start,end zoom factors, at least 1"},
+		{"loop-smooth", "false", "true or false"},
+	}},
+	{"reflect", "Mirror the top half into the bottom half as a rippling water reflection", []EffectParam{
+		{"reflect-ripple", "2", "pixels, 0 or more, or a start:end range"},
+	}},
+	{"morph", "Cross-dissolve from the input image to the -in2 image", []EffectParam{
+		{"in2", "", "image file or URL, the same size as -in"},
+		{"loop-smooth", "false", "true or false"},
+	}},
+	{"gradientmap", "Recolor the image by mapping its tones onto the -gradient colors", []EffectParam{
+		{"gradient", "#1b0c3f,#c2185b,#ffd54f", "at least two comma-separated colors"},
+		{"gradient-cycle", "false", "true or false"},
+	}},
+	{"bounce", "Drop the image so it bounces to rest, squashing on impact", []EffectParam{
+		{"bounce-height", "0.5", "fraction from 0 to 1, or a start:end range"},
+	}},
+	{"rgbjitter", "Shift the red, green and blue channels in circling directions for a 3D-glasses shimmer", []EffectParam{
+		{"jitter-amount", "3", "pixels, 0 or more"},
+	}},
+	{"cmyk", "Separate the image into print plates that drift out of register like a misaligned print", []EffectParam{
+		{"cmyk-offset", "2", "pixels, 0 or more"},
+	}},
+	{"recolor", "Cycle the hue of only the colors within -hue-range, leaving the rest unchanged", []EffectParam{
+		{"hue-range", "330:30", "low:high in degrees from 0 to 360"},
+	}},
+	{"tile", "Repeat the shrunken image in a grid that scrolls diagonally like wallpaper", []EffectParam{
+		{"tile-count", "3", "whole number, at least 1"},
+	}},
+	{"grow", "Scale the whole image up from -grow-from to full size in the center, like an emoji popping in", []EffectParam{
+		{"grow-from", "0", "fraction from 0 to 1"},
+		{"loop-smooth", "false", "true or false"},
+	}},
+	{"mirrortile", "Mirror a sliding quarter of the image into a symmetric 2x2 Rorschach pattern", nil},
+	{"channel", "Show only some of the red, green and blue channels, switching sets every frame", []EffectParam{
+		{"channel-order", "r,g,b,rg,gb,rb,rgb", "comma-separated sets of r, g and b"},
+	}},
+	{"outline", "Draw a stroke around the opaque parts of a transparent image, like a sticker", []EffectParam{
+		{"outline-width", "3", "pixels, at least 1"},
+		{"outline-color", "#ffffff", "hex color or color name"},
+		{"outline-cycle", "false", "true or false"},
+	}},
+	{"none", "Leave the image unchanged, e.g. to hold it still with none@start:end", nil},
+	{"zoomblur", "Streak the image outward from its center like a warp-speed zoom, growing over the frames", []EffectParam{
+		{"zoomblur-strength", "0.3", "0 or more"},
+		{"loop-smooth", "false", "true or false"},
+	}},
+	{"ascii", "Render the image as colored text characters on a black background, shimmering as the character grid slides", []EffectParam{
+		{"ascii-cell", "8", "pixels, at least 2"},
+		{"ascii-ramp", " .:-=+*#%@", "printable ASCII or shade block characters, darkest first"},
+	}},
+	{"jelly", "Wobble the image like jelly on a plate, springing between squashed and stretched as it settles", []EffectParam{
+		{"jelly-stiffness", "3", "wobbles per loop, above 0"},
+		{"jelly-damping", "3", "0 or more"},
+	}},
+}
+
+// LookupEffect returns the description of the named effect, if there is one.
+func LookupEffect(name string) (EffectInfo, bool) {
+	for _, info := range Effects {
+		if info.Name == name {
+			return info, true
+		}
+	}
+	return EffectInfo{}, false
+}
+
+// Aliases are short names for common chains of effects, which can be used
+// wherever an effect can. Each expands to its effects in order, and may name
+// other aliases, but only bare names: the suffixes of the alias are added
+// to each effect it expands to.
+var Aliases = map[string][]string{
+	"party":  {"hue", "vibes"},
+	"trippy": {"kaleidoscope", "ripple"},
+}
+
+// ExpandAliases returns the subcommands with every alias replaced by the
+// effects it stands for, each given the alias's +phase, ~mix and
+// @start:end suffixes, so "party@0:6" becomes "hue@0:6 vibes@0:6". Other
+// subcommands are returned unchanged. An alias that leads back to itself is
+// an error.
+func ExpandAliases(subcommands []string) ([]string, error) {
+	var expanded []string
+	for _, subcommand := range subcommands {
+		effects, err := expandAlias(subcommand, nil)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, effects...)
+	}
+	return expanded, nil
+}
+
+// expandAlias expands one subcommand, given the aliases being expanded that
+// led to it.
+func expandAlias(subcommand string, seen []string) ([]string, error) {
+	name, suffix := subcommand, ""
+	if i := strings.IndexAny(subcommand, "+~@"); i >= 0 {
+		name, suffix = subcommand[:i], subcommand[i:]
+	}
+	effects, ok := Aliases[name]
+	if !ok {
+		return []string{subcommand}, nil
+	}
+	if slices.Contains(seen, name) {
+		return nil, fmt.Errorf("alias %s refers to itself (%s)", name, strings.Join(append(seen, name), " -> "))
+	}
+
+	seen = append(seen, name)
+	var expanded []string
+	for _, effect := range effects {
+		sub, err := expandAlias(effect+suffix, seen)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, sub...)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,85 @@
+package animoji
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEffectsRegistry(t *testing.T) {
+	seen := map[string]bool{}
+	for _, info := range Effects {
+		if info.Name == "" || info.Description == "" {
+			t.Errorf("effect %q has no name or description", info.Name)
+		}
+		if seen[info.Name] {
+			t.Errorf("effect %s is listed twice", info.Name)
+		}
+		seen[info.Name] = true
+
+		if got, ok := LookupEffect(info.Name); !ok || got.Name != info.Name {
+			t.Errorf("LookupEffect(%q) = %q, %v", info.Name, got.Name, ok)
+		}
+	}
+	if _, ok := LookupEffect("no-such-effect"); ok {
+		t.Errorf("LookupEffect found an effect that doesn't exist")
+	}
+
+	for name := range Aliases {
+		if seen[name] {
+			t.Errorf("alias %s hides the effect of the same name", name)
+		}
+	}
+}
+
+func TestExpandAliases(t *testing.T) {
+	// Add aliases that nest and that loop, for the length of the test
+	for name, effects := range map[string][]string{
+		"both":   {"party", "zoom"},
+		"loop-a": {"hue", "loop-b"},
+		"loop-b": {"loop-a"},
+		"self":   {"self"},
+	} {
+		Aliases[name] = effects
+		t.Cleanup(func() { delete(Aliases, name) })
+	}
+
+	for _, tt := range []struct {
+		in   []string
+		want []string
+	}{
+		{[]string{"ripple", "zoom@2:4"}, []string{"ripple", "zoom@2:4"}},
+		{[]string{"party"}, []string{"hue", "vibes"}},
+		{[]string{"party@0:6"}, []string{"hue@0:6", "vibes@0:6"}},
+		{[]string{"zoom", "trippy+0.25~0.5@:3"}, []string{"zoom", "kaleidoscope+0.25~0.5@:3", "ripple+0.25~0.5@:3"}},
+		{[]string{"both~0.5"}, []string{"hue~0.5", "vibes~0.5", "zoom~0.5"}},
+	} {
+		got, err := ExpandAliases(tt.in)
+		if err != nil {
+			t.Errorf("ExpandAliases(%q): %v", tt.in, err)
+		} else if !slices.Equal(got, tt.want) {
+			t.Errorf("ExpandAliases(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"self", "loop-a", "loop-b@0:2", "zoom loop-b"} {
+		if got, err := ExpandAliases(strings.Fields(in)); err == nil {
+			t.Errorf("ExpandAliases(%q) = %q, expected an error for the loop", in, got)
+		}
+	}
+}
+
+func TestAliasesExpandToEffects(t *testing.T) {
+	for name := range Aliases {
+		effects, err := ExpandAliases([]string{name})
+		if err != nil {
+			t.Errorf("alias %s: %v", name, err)
+			continue
+		}
+		for _, effect := range effects {
+			if _, ok := LookupEffect(effect); !ok {
+				t.Errorf("alias %s expands to %s, which isn't an effect", name, effect)
+			}
+		}
+	}
+}
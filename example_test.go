@@ -0,0 +1,49 @@
+package animoji_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+
+	"animoji"
+)
+
+func ExampleApplyBytes() {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+
+	// Start from the command line's defaults and change what differs
+	opts := animoji.DefaultOptions()
+	opts.Frames = 4
+	opts.Delay = 10
+	data, err := animoji.ApplyBytes(img, []string{"ripple", "hue"}, opts)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%d frames of %v, %d/100s apart\n", len(anim.Image), anim.Image[0].Bounds().Size(), anim.Delay[0])
+	// Output: 4 frames of (32,32), 10/100s apart
+}
+
+func ExampleLookupEffect() {
+	info, ok := animoji.LookupEffect("spotlight")
+	if !ok {
+		return
+	}
+	fmt.Println(info.Description)
+	for _, param := range info.Params {
+		fmt.Printf("-%s (default %s): %s\n", param.Flag, param.Default, param.Range)
+	}
+	// Output:
+	// Sweep a tinted circular highlight around the image
+	// -spotlight-color (default #ffff00): hex color or color name
+	// -spotlight-radius (default 0.25): above 0, or a start:end range
+}
@@ -0,0 +1,132 @@
+package animoji
+
+import (
+	"encoding/binary"
+	"image"
+)
+
+// jpegOrientation returns the EXIF orientation tag (1-8) of JPEG data,
+// or 1 (normal) if it is missing or can't be parsed.
+func jpegOrientation(data []byte) int {
+	// Check for the SOI marker
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the marker segments looking for the APP1 Exif segment
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+
+		// Image data starts at SOS, so no more metadata follows
+		if marker == 0xDA {
+			return 1
+		}
+
+		segmentStart := pos + 4
+		segmentEnd := pos + 2 + length
+		if length < 2 || segmentEnd > len(data) {
+			return 1
+		}
+
+		segment := data[segmentStart:segmentEnd]
+		if marker == 0xE1 && len(segment) >= 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+
+		pos = segmentEnd
+	}
+
+	return 1
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of TIFF
+// formatted EXIF data.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	// Byte order is given by the "II" (Intel) or "MM" (Motorola) header
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:]))
+	if ifdOffset+2 > len(tiff) {
+		return 1
+	}
+
+	// Each IFD entry is 12 bytes: tag, type, count, value
+	entries := int(order.Uint16(tiff[ifdOffset:]))
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+
+	return 1
+}
+
+// applyOrientation rotates and flips the image so that an image with the
+// given EXIF orientation is displayed upright.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Orientations 5-8 swap width and height
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			// Map destination pixel to source coordinates
+			var srcX, srcY int
+			switch orientation {
+			case 2: // Flip horizontal
+				srcX, srcY = width-1-x, y
+			case 3: // Rotate 180
+				srcX, srcY = width-1-x, height-1-y
+			case 4: // Flip vertical
+				srcX, srcY = x, height-1-y
+			case 5: // Transpose
+				srcX, srcY = y, x
+			case 6: // Rotate 90 clockwise
+				srcX, srcY = y, height-1-x
+			case 7: // Transverse
+				srcX, srcY = width-1-y, height-1-x
+			case 8: // Rotate 90 counter-clockwise
+				srcX, srcY = width-1-y, x
+			}
+			dst.Set(x, y, img.At(srcX+bounds.Min.X, srcY+bounds.Min.Y))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,134 @@
+package animoji
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+)
+
+// gifStreamEncoder writes an animated GIF one frame at a time, so the frames
+// never all need to be held in memory. Every frame must use the palette
+// passed to newGIFStreamEncoder, which is written as the global color table.
+type gifStreamEncoder struct {
+	w       io.Writer
+	config  image.Config
+	comment string
+	frames  int
+	buf     bytes.Buffer
+}
+
+func newGIFStreamEncoder(w io.Writer, width, height int, palette color.Palette, comment string) *gifStreamEncoder {
+	return &gifStreamEncoder{
+		w: w,
+		config: image.Config{
+			ColorModel: palette,
+			Width:      width,
+			Height:     height,
+		},
+		comment: comment,
+	}
+}
+
+// WriteFrame encodes a frame with the given delay (in 100ths of a second)
+// and disposal method (0 = unspecified).
+func (e *gifStreamEncoder) WriteFrame(frame *image.Paletted, delay int, disposal byte) error {
+	// The stdlib encoder only writes whole GIFs, so encode a single frame
+	// GIF and copy out the blocks that are needed
+	anim := &gif.GIF{
+		Image:  []*image.Paletted{frame},
+		Delay:  []int{delay},
+		Config: e.config,
+	}
+	if disposal != 0 {
+		anim.Disposal = []byte{disposal}
+	}
+
+	e.buf.Reset()
+	if err := gif.EncodeAll(&e.buf, anim); err != nil {
+		return err
+	}
+	data := e.buf.Bytes()
+
+	headerLen, err := gifHeaderLength(data)
+	if err != nil {
+		return err
+	}
+
+	// The first frame also writes the header, looping and comment extensions
+	if e.frames == 0 {
+		if _, err := e.w.Write(data[:headerLen]); err != nil {
+			return err
+		}
+		if _, err := e.w.Write(loopExtension()); err != nil {
+			return err
+		}
+		if e.comment != "" {
+			if _, err := e.w.Write(commentExtension(e.comment)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Copy the graphic control extension and image data, without the trailer
+	if _, err := e.w.Write(data[headerLen : len(data)-1]); err != nil {
+		return err
+	}
+	e.frames++
+
+	return nil
+}
+
+// Close writes the GIF trailer. It does not close the underlying writer.
+func (e *gifStreamEncoder) Close() error {
+	if e.frames == 0 {
+		return fmt.Errorf("gif: must provide at least one image")
+	}
+	_, err := e.w.Write([]byte{0x3B})
+	return err
+}
+
+// gifHeaderLength returns the length of the header, logical screen
+// descriptor and global color table at the start of encoded GIF data.
+func gifHeaderLength(data []byte) (int, error) {
+	// Header (6 bytes) + logical screen descriptor (7 bytes)
+	length := 13
+	if len(data) < length || string(data[:4]) != "GIF8" {
+		return 0, fmt.Errorf("invalid GIF data")
+	}
+
+	// Skip the global color table if present
+	packed := data[10]
+	if packed&0x80 != 0 {
+		length += 3 * (1 << ((packed & 0x07) + 1))
+	}
+	if len(data) < length {
+		return 0, fmt.Errorf("invalid GIF data: truncated color table")
+	}
+
+	return length, nil
+}
+
+// loopExtension returns a NETSCAPE2.0 application extension that makes the
+// animation loop forever.
+func loopExtension() []byte {
+	block := []byte{0x21, 0xFF, 0x0B}
+	block = append(block, "NETSCAPE2.0"...)
+	return append(block, 0x03, 0x01, 0x00, 0x00, 0x00)
+}
+
+// commentExtension returns a comment extension block containing the text.
+func commentExtension(comment string) []byte {
+	// Introducer, label, data sub-blocks of up to 255 bytes, terminator
+	block := []byte{0x21, 0xFE}
+	text := []byte(comment)
+	for len(text) > 0 {
+		n := min(len(text), 255)
+		block = append(block, byte(n))
+		block = append(block, text[:n]...)
+		text = text[n:]
+	}
+	return append(block, 0x00)
+}
@@ -1,3 +1,5 @@
 module animoji
 
 go 1.24.9
+
+require golang.org/x/image v0.36.0
@@ -0,0 +1,224 @@
+package animoji
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Manifest describes a rendered animation. It is written as JSON by
+// -manifest, as a structured counterpart to the -comment text.
+type Manifest struct {
+	Version  string           `json:"version"`
+	Width    int              `json:"width"`
+	Height   int              `json:"height"`
+	Frames   int              `json:"frames"`
+	Delays   []int            `json:"delays"`   // Delay of each frame, in 100ths of a second
+	Duration float64          `json:"duration"` // Length of one loop, in seconds
+	Effects  []ManifestEffect `json:"effects"`
+	Colors   int              `json:"colors"` // Number of colors in the GIF palette
+	Seed     int64            `json:"seed"`
+	Bytes    int64            `json:"bytes"` // Size of the GIF
+}
+
+// ManifestEffect describes one effect of the pipeline, in order.
+type ManifestEffect struct {
+	Name   string            `json:"name"`
+	Phase  float64           `json:"phase,omitempty"` // Fraction of a cycle a looping effect is shifted ahead by
+	Mix    float64           `json:"mix"`
+	Start  int               `json:"start"`            // First frame the effect applies to
+	End    int               `json:"end"`              // Frame after the last one the effect applies to
+	Burst  int               `json:"burst,omitempty"`  // Frames from the start of one burst to the next, if the effect only applies in bursts
+	Params map[string]string `json:"params,omitempty"` // Flags the effect reads, with the values the options give them
+}
+
+// BuildManifest describes an animation of the given size, rendered with the
+// effects and options and encoded with the palette into a GIF of the given
+// number of bytes. Options left zero are described by their defaults.
+func BuildManifest(size image.Point, effects []EffectSpec, palette color.Palette, opts Options, bytes int64) Manifest {
+	opts = opts.withDefaults()
+
+	// Optimized GIFs reserve a palette entry for transparency
+	if opts.Optimize {
+		palette, _ = reserveTransparent(palette)
+	}
+
+	m := Manifest{
+		Version: Version,
+		Width:   size.X,
+		Height:  size.Y,
+		Frames:  opts.Frames,
+		Delays:  make([]int, opts.Frames),
+		Effects: make([]ManifestEffect, len(effects)),
+		Colors:  len(palette),
+		Seed:    opts.Seed,
+		Bytes:   bytes,
+	}
+
+	total := 0
+	for i := range m.Delays {
+		m.Delays[i] = frameDelay(opts.Delay, i)
+		total += m.Delays[i]
+	}
+	m.Duration = float64(total) / 100.0
+
+	for i, effect := range effects {
+		start, end := effect.Stage(opts.Frames)
+		e := ManifestEffect{Name: effect.Name, Phase: effect.Phase, Mix: effect.Mix, Start: start, End: end, Burst: opts.Bursts[effect.Name]}
+		info, _ := LookupEffect(effect.Name)
+		for _, param := range info.Params {
+			if value, ok := opts.paramValue(param.Flag); ok {
+				if e.Params == nil {
+					e.Params = map[string]string{}
+				}
+				e.Params[param.Flag] = value
+			}
+		}
+		m.Effects[i] = e
+	}
+
+	return m
+}
+
+// paramValue returns the value of the effect parameter set by the named
+// command line flag, written as it would be given on the command line, with
+// start:end for a ramped parameter. It reports false for flags that don't
+// map onto an option, such as -in2.
+func (o Options) paramValue(name string) (string, bool) {
+	if ramp, ok := o.Ramps[name]; ok {
+		return formatFloat(ramp[0]) + ":" + formatFloat(ramp[1]), true
+	}
+	pair := func(p [2]float64) string {
+		return formatFloat(p[0]) + "," + formatFloat(p[1])
+	}
+
+	switch name {
+	case "easing":
+		return o.Easing, true
+	case "spins":
+		return strconv.Itoa(o.Spins), true
+	case "hue-cycles":
+		return strconv.Itoa(o.HueCycles), true
+	case "pixelate-grid":
+		return strconv.Itoa(o.PixelateGrid), true
+	case "pixelate-reverse":
+		return strconv.FormatBool(o.PixelateReverse), true
+	case "pixelate-shape":
+		return o.PixelateShape, true
+	case "vibes-smooth":
+		return strconv.FormatBool(o.VibesSmooth), true
+	case "vibes-feather":
+		return strconv.Itoa(o.VibesFeather), true
+	case "kaleidoscope-zoom":
+		return formatFloat(o.KaleidoscopeZoom), true
+	case "kaleidoscope-reflect":
+		return strconv.FormatBool(o.KaleidoscopeReflect), true
+	case "center":
+		return pair(o.Center), true
+	case "ripple-mode":
+		return o.RippleMode, true
+	case "ripple-angle":
+		return formatFloat(o.RippleAngle), true
+	case "ripple-edge":
+		return o.RippleEdge, true
+	case "loop-smooth":
+		return strconv.FormatBool(o.LoopSmooth), true
+	case "spotlight-color":
+		return formatColor(o.SpotlightColor), true
+	case "spotlight-radius":
+		return formatFloat(o.SpotlightRadius), true
+	case "pinch-strength":
+		return formatFloat(o.PinchStrength), true
+	case "twirl-turns":
+		return formatFloat(o.TwirlTurns), true
+	case "glow-intensity":
+		return formatFloat(o.GlowIntensity), true
+	case "glow-radius":
+		return strconv.Itoa(o.GlowRadius), true
+	case "heat-amplitude":
+		return formatFloat(o.HeatAmplitude), true
+	case "kenburns-from":
+		return pair(o.KenBurnsFrom), true
+	case "kenburns-to":
+		return pair(o.KenBurnsTo), true
+	case "kenburns-zoom":
+		return pair(o.KenBurnsZoom), true
+	case "reflect-ripple":
+		return formatFloat(o.ReflectRipple), true
+	case "gradient":
+		stops := make([]string, len(o.GradientStops))
+		for i, stop := range o.GradientStops {
+			stops[i] = formatColor(stop)
+		}
+		return strings.Join(stops, ","), true
+	case "gradient-cycle":
+		return strconv.FormatBool(o.GradientCycle), true
+	case "bounce-height":
+		return formatFloat(o.BounceHeight), true
+	case "jitter-amount":
+		return strconv.Itoa(o.JitterAmount), true
+	case "cmyk-offset":
+		return strconv.Itoa(o.CMYKOffset), true
+	case "hue-range":
+		return formatFloat(o.HueRange[0]) + ":" + formatFloat(o.HueRange[1]), true
+	case "tile-count":
+		return strconv.Itoa(o.TileCount), true
+	case "grow-from":
+		return formatFloat(o.GrowFrom), true
+	case "channel-order":
+		sets := make([]string, len(o.ChannelOrder))
+		for i, channels := range o.ChannelOrder {
+			for j, letter := range "rgb" {
+				if channels[j] {
+					sets[i] += string(letter)
+				}
+			}
+		}
+		return strings.Join(sets, ","), true
+	case "outline-width":
+		return strconv.Itoa(o.OutlineWidth), true
+	case "outline-color":
+		return formatColor(o.OutlineColor), true
+	case "outline-cycle":
+		return strconv.FormatBool(o.OutlineCycle), true
+	case "zoomblur-strength":
+		return formatFloat(o.ZoomBlurStrength), true
+	case "ascii-cell":
+		return strconv.Itoa(o.ASCIICell), true
+	case "ascii-ramp":
+		return string(o.ASCIIRamp), true
+	case "jelly-stiffness":
+		return formatFloat(o.JellyStiffness), true
+	case "jelly-damping":
+		return formatFloat(o.JellyDamping), true
+	}
+	return "", false
+}
+
+// formatFloat writes a float parameter in the shortest form that parses back
+// to the same value, as the flag package does.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// formatColor writes a color as a #RRGGBB hex value, or #RRGGBBAA if it
+// isn't opaque.
+func formatColor(c color.RGBA) string {
+	if c.A != 255 {
+		return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// WriteManifest writes the manifest to a file as indented JSON.
+func WriteManifest(filename string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o666)
+}
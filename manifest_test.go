@@ -0,0 +1,44 @@
+package animoji
+
+import (
+	"image"
+	"image/color"
+	"maps"
+	"testing"
+)
+
+func TestBuildManifestParams(t *testing.T) {
+	effects := []EffectSpec{{Name: "glow", Mix: 1}, {Name: "outline", Mix: 1}, {Name: "channel", Mix: 1}, {Name: "mirrortile", Mix: 1}}
+	opts := Options{
+		Frames:        4,
+		GlowIntensity: 0.5,
+		Ramps:         map[string][2]float64{"glow-intensity": {0.5, 2}},
+		OutlineColor:  color.RGBA{255, 0, 0, 255},
+		ChannelOrder:  [][3]bool{{true, false, false}, {false, true, true}},
+	}
+	m := BuildManifest(image.Pt(8, 8), effects, nil, opts, 0)
+
+	// Values come from the options, with the defaults of those left zero
+	for i, want := range []map[string]string{
+		{"glow-intensity": "0.5:2", "glow-radius": "4"},
+		{"outline-width": "3", "outline-color": "#ff0000", "outline-cycle": "false"},
+		{"channel-order": "r,gb"},
+		nil,
+	} {
+		if got := m.Effects[i].Params; !maps.Equal(got, want) {
+			t.Errorf("%s params = %v, want %v", effects[i].Name, got, want)
+		}
+	}
+}
+
+func TestParamValueCoversEffects(t *testing.T) {
+	// Every effect parameter except the second input's path is an option
+	opts := Options{}.withDefaults()
+	for _, info := range Effects {
+		for _, param := range info.Params {
+			if _, ok := opts.paramValue(param.Flag); !ok && param.Flag != "in2" {
+				t.Errorf("%s: no option for -%s", info.Name, param.Flag)
+			}
+		}
+	}
+}
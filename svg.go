@@ -0,0 +1,782 @@
+package animoji
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/vector"
+)
+
+// IsSVG reports whether the input path names an SVG file.
+func IsSVG(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".svg")
+}
+
+// LoadSVG rasterizes an SVG file to an image width pixels wide, with the
+// height following the drawing's aspect ratio, or at the drawing's own size
+// if width is 0. A drawing that would rasterize to more than maxPixels
+// pixels (0 = unlimited) is an error, found before any memory is allocated
+// for it.
+func LoadSVG(filename string, width int, maxPixels int64) (*image.RGBA, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return decodeSVG(file, width, maxPixels)
+}
+
+// svgMaxSize is the largest width or height an SVG is rasterized at, the
+// most a GIF can have.
+const svgMaxSize = 65535
+
+// decodeSVG rasterizes an SVG document as LoadSVG does. Only filled shapes
+// are drawn: path, rect, circle, ellipse, polygon and polyline elements,
+// within any nesting of groups and transforms, filled with solid colors.
+// Strokes, text and embedded images are left out, and fills that refer to
+// gradients or patterns are reported as errors, as are malformed documents.
+func decodeSVG(r io.Reader, width int, maxPixels int64) (*image.RGBA, error) {
+	d := xml.NewDecoder(r)
+	var s *svgRenderer
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SVG: %w", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if s == nil {
+				if tok.Name.Local != "svg" {
+					return nil, fmt.Errorf("not an SVG image (root element is <%s>)", tok.Name.Local)
+				}
+				s, err = newSVGRenderer(tok, width, maxPixels)
+				if err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := s.start(d, tok); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			if s != nil {
+				s.end()
+			}
+		}
+	}
+	if s == nil {
+		return nil, errors.New("not an SVG image (no <svg> element)")
+	}
+	return s.dst, nil
+}
+
+// svgStyle holds the inherited painting properties of an SVG element.
+type svgStyle struct {
+	fill      color.RGBA // Fill color, unpremultiplied
+	noFill    bool       // fill="none"
+	opacity   float64    // Product of fill-opacity and opacity
+	transform svgMatrix  // From the element's user space to pixels
+}
+
+// svgMatrix is an affine transform [a c e; b d f], as in SVG's matrix().
+type svgMatrix [6]float64
+
+// mul returns the transform that applies n and then m.
+func (m svgMatrix) mul(n svgMatrix) svgMatrix {
+	return svgMatrix{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+// apply transforms the point (x, y).
+func (m svgMatrix) apply(x, y float64) (float32, float32) {
+	return float32(m[0]*x + m[2]*y + m[4]), float32(m[1]*x + m[3]*y + m[5])
+}
+
+// svgRenderer draws the elements of an SVG document as they are decoded.
+type svgRenderer struct {
+	dst   *image.RGBA
+	z     *vector.Rasterizer
+	stack []svgStyle // Style of each open element, innermost last
+}
+
+// newSVGRenderer sizes the output from the root <svg> element's width,
+// height and viewBox, and maps the viewBox onto it.
+func newSVGRenderer(root xml.StartElement, width int, maxPixels int64) (*svgRenderer, error) {
+	attrs := svgAttrs(root)
+	w, _ := svgLength(attrs["width"])
+	h, _ := svgLength(attrs["height"])
+
+	var viewBox [4]float64
+	if vb, ok := attrs["viewBox"]; ok {
+		nums, err := svgNumbers(vb)
+		if err != nil || len(nums) != 4 || nums[2] <= 0 || nums[3] <= 0 {
+			return nil, fmt.Errorf("invalid SVG viewBox '%s'", vb)
+		}
+		copy(viewBox[:], nums)
+	} else {
+		viewBox = [4]float64{0, 0, w, h}
+	}
+	if w <= 0 || h <= 0 {
+		w, h = viewBox[2], viewBox[3]
+	}
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("SVG has no size (needs width and height or a viewBox)")
+	}
+
+	// Rasterize at the requested width, keeping the aspect ratio the way
+	// ResizeImage does
+	if width > 0 {
+		w, h = float64(width), float64(width)*h/w
+	}
+	if w > svgMaxSize || h > svgMaxSize {
+		return nil, fmt.Errorf("SVG is too large to rasterize at %gx%g (at most %dx%d)", w, h, svgMaxSize, svgMaxSize)
+	}
+	size := image.Pt(int(math.Ceil(w)), max(1, int(h)))
+	if pixels := int64(size.X) * int64(size.Y); maxPixels > 0 && pixels > maxPixels {
+		return nil, fmt.Errorf("SVG is too large to rasterize at %dx%d: %d pixels, over the limit of %d", size.X, size.Y, pixels, maxPixels)
+	}
+
+	scaleX := float64(size.X) / viewBox[2]
+	scaleY := float64(size.Y) / viewBox[3]
+	base := svgMatrix{scaleX, 0, 0, scaleY, -viewBox[0] * scaleX, -viewBox[1] * scaleY}
+
+	s := &svgRenderer{
+		dst: image.NewRGBA(image.Rectangle{Max: size}),
+		z:   vector.NewRasterizer(size.X, size.Y),
+	}
+	style, err := svgInherit(svgStyle{fill: color.RGBA{0, 0, 0, 255}, opacity: 1, transform: base}, attrs)
+	if err != nil {
+		return nil, err
+	}
+	s.stack = append(s.stack, style)
+	return s, nil
+}
+
+// start handles an element's start tag, drawing it if it is a shape.
+// Elements that define things to draw elsewhere, or that aren't drawn, are
+// skipped along with their children.
+func (s *svgRenderer) start(d *xml.Decoder, el xml.StartElement) error {
+	switch el.Name.Local {
+	case "defs", "clipPath", "mask", "symbol", "marker", "pattern", "linearGradient", "radialGradient",
+		"text", "image", "style", "script", "title", "desc", "metadata", "foreignObject":
+		return d.Skip()
+	}
+
+	attrs := svgAttrs(el)
+	style, err := svgInherit(s.stack[len(s.stack)-1], attrs)
+	if err != nil {
+		return fmt.Errorf("<%s>: %w", el.Name.Local, err)
+	}
+	s.stack = append(s.stack, style)
+
+	s.z.Reset(s.dst.Bounds().Dx(), s.dst.Bounds().Dy())
+	p := svgPath{z: s.z, m: style.transform}
+	switch el.Name.Local {
+	case "path":
+		err = p.data(attrs["d"])
+	case "rect":
+		err = p.rect(attrs)
+	case "circle", "ellipse":
+		err = p.ellipse(attrs, el.Name.Local == "circle")
+	case "polygon", "polyline":
+		err = p.polygon(attrs["points"])
+	default:
+		// Groups and nested svg elements only pass on their style
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("<%s>: %w", el.Name.Local, err)
+	}
+
+	if style.noFill || style.opacity <= 0 {
+		return nil
+	}
+	fill := color.NRGBA{style.fill.R, style.fill.G, style.fill.B, uint8(math.Round(float64(style.fill.A) * style.opacity))}
+	s.z.DrawOp = draw.Over
+	s.z.Draw(s.dst, s.dst.Bounds(), image.NewUniform(fill), image.Point{})
+	return nil
+}
+
+// end handles an element's end tag.
+func (s *svgRenderer) end() {
+	if len(s.stack) > 1 {
+		s.stack = s.stack[:len(s.stack)-1]
+	}
+}
+
+// svgAttrs returns an element's attributes by name, with the properties in
+// a style attribute taking precedence over the attributes themselves.
+func svgAttrs(el xml.StartElement) map[string]string {
+	attrs := make(map[string]string, len(el.Attr))
+	for _, a := range el.Attr {
+		attrs[a.Name.Local] = strings.TrimSpace(a.Value)
+	}
+	for _, decl := range strings.Split(attrs["style"], ";") {
+		if name, value, ok := strings.Cut(decl, ":"); ok {
+			attrs[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return attrs
+}
+
+// svgInherit returns the style of an element with the given attributes
+// inside an element with the parent style.
+func svgInherit(parent svgStyle, attrs map[string]string) (svgStyle, error) {
+	style := parent
+	if fill, ok := attrs["fill"]; ok {
+		switch {
+		case fill == "none":
+			style.noFill = true
+		case fill == "currentColor" || fill == "inherit":
+		case strings.HasPrefix(fill, "url("):
+			return style, fmt.Errorf("unsupported fill '%s' (only solid colors are supported)", fill)
+		default:
+			c, err := svgColor(fill)
+			if err != nil {
+				return style, err
+			}
+			style.fill = c
+			style.noFill = false
+		}
+	}
+	for _, name := range []string{"fill-opacity", "opacity"} {
+		if v, ok := attrs[name]; ok {
+			opacity, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return style, fmt.Errorf("invalid %s '%s'", name, v)
+			}
+			style.opacity *= math.Max(0, math.Min(1, opacity))
+		}
+	}
+	if t, ok := attrs["transform"]; ok {
+		m, err := svgTransform(t)
+		if err != nil {
+			return style, err
+		}
+		style.transform = style.transform.mul(m)
+	}
+	return style, nil
+}
+
+// svgColor parses an SVG color: a hex color or name as accepted by
+// ParseHexColor, or rgb(r, g, b) with values from 0 to 255. The result is
+// unpremultiplied.
+func svgColor(s string) (color.RGBA, error) {
+	if args, ok := strings.CutPrefix(s, "rgb("); ok {
+		nums, err := svgNumbers(strings.TrimSuffix(args, ")"))
+		if err != nil || len(nums) != 3 {
+			return color.RGBA{}, fmt.Errorf("invalid color '%s'", s)
+		}
+		return color.RGBA{clamp8(nums[0] + 0.5), clamp8(nums[1] + 0.5), clamp8(nums[2] + 0.5), 255}, nil
+	}
+	c, err := ParseHexColor(s)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return color.RGBA{n.R, n.G, n.B, n.A}, nil
+}
+
+// svgTransform parses a transform attribute, a list of translate, scale,
+// rotate, skewX, skewY and matrix functions applied right to left.
+func svgTransform(s string) (svgMatrix, error) {
+	m := svgMatrix{1, 0, 0, 1, 0, 0}
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		name, args, ok := strings.Cut(rest, "(")
+		if !ok {
+			return m, fmt.Errorf("invalid transform '%s'", s)
+		}
+		args, rest, ok = strings.Cut(args, ")")
+		if !ok {
+			return m, fmt.Errorf("invalid transform '%s'", s)
+		}
+		rest = strings.TrimLeft(rest, " \t\r\n,")
+		nums, err := svgNumbers(args)
+		if err != nil {
+			return m, fmt.Errorf("invalid transform '%s'", s)
+		}
+
+		arg := func(i int, def float64) float64 {
+			if i < len(nums) {
+				return nums[i]
+			}
+			return def
+		}
+		var t svgMatrix
+		switch strings.TrimSpace(name) {
+		case "matrix":
+			if len(nums) != 6 {
+				return m, fmt.Errorf("invalid transform '%s'", s)
+			}
+			copy(t[:], nums)
+		case "translate":
+			t = svgMatrix{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			t = svgMatrix{arg(0, 1), 0, 0, arg(1, arg(0, 1)), 0, 0}
+		case "rotate":
+			a := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			t = svgMatrix{1, 0, 0, 1, cx, cy}.
+				mul(svgMatrix{math.Cos(a), math.Sin(a), -math.Sin(a), math.Cos(a), 0, 0}).
+				mul(svgMatrix{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			t = svgMatrix{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = svgMatrix{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			return m, fmt.Errorf("invalid transform '%s'", s)
+		}
+		m = m.mul(t)
+	}
+	return m, nil
+}
+
+// svgLength parses a length in user units or pixels, such as "24" or
+// "24px". Percentages, other units and lengths that aren't finite aren't
+// supported.
+func svgLength(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "px"), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// svgNumbers parses a list of numbers separated by whitespace or commas.
+func svgNumbers(s string) ([]float64, error) {
+	sc := svgScanner{s: s}
+	var nums []float64
+	for {
+		sc.skipSeparators()
+		if sc.done() {
+			return nums, nil
+		}
+		v, err := sc.number()
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, v)
+	}
+}
+
+// svgScanner reads numbers from path data and attribute lists, which may be
+// run together, as in "M10-5.5.5".
+type svgScanner struct {
+	s string
+	i int
+}
+
+func (sc *svgScanner) done() bool {
+	return sc.i >= len(sc.s)
+}
+
+func (sc *svgScanner) skipSeparators() {
+	for !sc.done() && strings.IndexByte(" \t\r\n,", sc.s[sc.i]) >= 0 {
+		sc.i++
+	}
+}
+
+// number reads the next number, which ends at the first character that
+// can't continue it.
+func (sc *svgScanner) number() (float64, error) {
+	sc.skipSeparators()
+	start := sc.i
+	if !sc.done() && (sc.s[sc.i] == '-' || sc.s[sc.i] == '+') {
+		sc.i++
+	}
+	seenDot := false
+	for !sc.done() {
+		c := sc.s[sc.i]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' && !seenDot:
+			seenDot = true
+		case (c == 'e' || c == 'E') && sc.i > start:
+			// Take the exponent and its sign
+			sc.i++
+			if !sc.done() && (sc.s[sc.i] == '-' || sc.s[sc.i] == '+') {
+				sc.i++
+			}
+			for !sc.done() && sc.s[sc.i] >= '0' && sc.s[sc.i] <= '9' {
+				sc.i++
+			}
+			return sc.parse(start)
+		default:
+			return sc.parse(start)
+		}
+		sc.i++
+	}
+	return sc.parse(start)
+}
+
+func (sc *svgScanner) parse(start int) (float64, error) {
+	v, err := strconv.ParseFloat(sc.s[start:sc.i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number at '%s'", sc.s[start:])
+	}
+	return v, nil
+}
+
+// flag reads an arc flag, a single 0 or 1 that needn't be separated from
+// what follows it.
+func (sc *svgScanner) flag() (bool, error) {
+	sc.skipSeparators()
+	if sc.done() || (sc.s[sc.i] != '0' && sc.s[sc.i] != '1') {
+		return false, fmt.Errorf("invalid arc flag at '%s'", sc.s[sc.i:])
+	}
+	sc.i++
+	return sc.s[sc.i-1] == '1', nil
+}
+
+// svgPath builds the outline of a shape in the rasterizer, transforming
+// points from user space to pixels.
+type svgPath struct {
+	z *vector.Rasterizer
+	m svgMatrix
+
+	x, y         float64 // Current point
+	startX       float64 // Start of the current subpath
+	startY       float64
+	ctrlX, ctrlY float64 // Last control point, for smooth curves
+	open         bool    // Whether a subpath is in progress
+}
+
+func (p *svgPath) moveTo(x, y float64) {
+	p.close()
+	p.z.MoveTo(p.m.apply(x, y))
+	p.x, p.y, p.startX, p.startY, p.ctrlX, p.ctrlY = x, y, x, y, x, y
+	p.open = true
+}
+
+func (p *svgPath) lineTo(x, y float64) {
+	p.z.LineTo(p.m.apply(x, y))
+	p.x, p.y, p.ctrlX, p.ctrlY = x, y, x, y
+}
+
+func (p *svgPath) quadTo(x1, y1, x, y float64) {
+	bx, by := p.m.apply(x1, y1)
+	cx, cy := p.m.apply(x, y)
+	p.z.QuadTo(bx, by, cx, cy)
+	p.x, p.y, p.ctrlX, p.ctrlY = x, y, x1, y1
+}
+
+func (p *svgPath) cubeTo(x1, y1, x2, y2, x, y float64) {
+	bx, by := p.m.apply(x1, y1)
+	cx, cy := p.m.apply(x2, y2)
+	dx, dy := p.m.apply(x, y)
+	p.z.CubeTo(bx, by, cx, cy, dx, dy)
+	p.x, p.y, p.ctrlX, p.ctrlY = x, y, x2, y2
+}
+
+// close ends the current subpath, returning to its start, since every
+// shape is filled.
+func (p *svgPath) close() {
+	if p.open {
+		p.z.ClosePath()
+		p.x, p.y, p.ctrlX, p.ctrlY = p.startX, p.startY, p.startX, p.startY
+		p.open = false
+	}
+}
+
+// arcTo draws an elliptical arc to (x, y) as in the path A command, as line
+// segments of at most 10 degrees.
+func (p *svgPath) arcTo(rx, ry, rotation float64, large, sweep bool, x, y float64) {
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || (x == p.x && y == p.y) {
+		p.lineTo(x, y)
+		return
+	}
+
+	// Convert from endpoints to a center and angles, following the SVG
+	// implementation notes
+	phi := rotation * math.Pi / 180
+	cos, sin := math.Cos(phi), math.Sin(phi)
+	dx, dy := (p.x-x)/2, (p.y-y)/2
+	x1 := cos*dx + sin*dy
+	y1 := -sin*dx + cos*dy
+
+	// Scale up radii that are too small to reach
+	if l := x1*x1/(rx*rx) + y1*y1/(ry*ry); l > 1 {
+		rx *= math.Sqrt(l)
+		ry *= math.Sqrt(l)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	k := math.Sqrt(math.Max(0, num/den))
+	if large == sweep {
+		k = -k
+	}
+	cx1 := k * rx * y1 / ry
+	cy1 := -k * ry * x1 / rx
+	cx := cos*cx1 - sin*cy1 + (p.x+x)/2
+	cy := sin*cx1 + cos*cy1 + (p.y+y)/2
+
+	start := math.Atan2((y1-cy1)/ry, (x1-cx1)/rx)
+	end := math.Atan2((-y1-cy1)/ry, (-x1-cx1)/rx)
+	delta := end - start
+	if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	} else if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	}
+
+	steps := max(1, int(math.Ceil(math.Abs(delta)/(math.Pi/18))))
+	for i := 1; i < steps; i++ {
+		a := start + delta*float64(i)/float64(steps)
+		ex, ey := rx*math.Cos(a), ry*math.Sin(a)
+		p.lineTo(cos*ex-sin*ey+cx, sin*ex+cos*ey+cy)
+	}
+	p.lineTo(x, y)
+}
+
+// data builds the path from its d attribute.
+func (p *svgPath) data(d string) error {
+	sc := svgScanner{s: d}
+	cmd := byte(0)
+	for {
+		sc.skipSeparators()
+		if sc.done() {
+			break
+		}
+		if c := sc.s[sc.i]; strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", c) >= 0 {
+			cmd = c
+			sc.i++
+		} else if cmd == 0 {
+			return fmt.Errorf("invalid path data at '%s'", sc.s[sc.i:])
+		}
+
+		// Read the command's arguments, relative to the current point for
+		// lower case commands
+		rel := cmd >= 'a'
+		var nums [7]float64
+		read := func(n int) error {
+			for i := 0; i < n; i++ {
+				v, err := sc.number()
+				if err != nil {
+					return err
+				}
+				nums[i] = v
+			}
+			return nil
+		}
+		point := func(i int) (float64, float64) {
+			if rel {
+				return p.x + nums[i], p.y + nums[i+1]
+			}
+			return nums[i], nums[i+1]
+		}
+
+		var err error
+		switch cmd {
+		case 'M', 'm':
+			if err = read(2); err == nil {
+				p.moveTo(point(0))
+				// Further pairs are lines
+				if cmd == 'M' {
+					cmd = 'L'
+				} else {
+					cmd = 'l'
+				}
+			}
+		case 'L', 'l':
+			if err = read(2); err == nil {
+				p.lineTo(point(0))
+			}
+		case 'H', 'h':
+			if err = read(1); err == nil {
+				x := nums[0]
+				if rel {
+					x += p.x
+				}
+				p.lineTo(x, p.y)
+			}
+		case 'V', 'v':
+			if err = read(1); err == nil {
+				y := nums[0]
+				if rel {
+					y += p.y
+				}
+				p.lineTo(p.x, y)
+			}
+		case 'C', 'c':
+			if err = read(6); err == nil {
+				x1, y1 := point(0)
+				x2, y2 := point(2)
+				x, y := point(4)
+				p.cubeTo(x1, y1, x2, y2, x, y)
+			}
+		case 'S', 's':
+			if err = read(4); err == nil {
+				x2, y2 := point(0)
+				x, y := point(2)
+				p.cubeTo(2*p.x-p.ctrlX, 2*p.y-p.ctrlY, x2, y2, x, y)
+			}
+		case 'Q', 'q':
+			if err = read(4); err == nil {
+				x1, y1 := point(0)
+				x, y := point(2)
+				p.quadTo(x1, y1, x, y)
+			}
+		case 'T', 't':
+			if err = read(2); err == nil {
+				x, y := point(0)
+				p.quadTo(2*p.x-p.ctrlX, 2*p.y-p.ctrlY, x, y)
+			}
+		case 'A', 'a':
+			var large, sweep bool
+			if err = read(3); err == nil {
+				rx, ry, rotation := nums[0], nums[1], nums[2]
+				if large, err = sc.flag(); err == nil {
+					if sweep, err = sc.flag(); err == nil {
+						if err = read(2); err == nil {
+							x, y := point(0)
+							p.arcTo(rx, ry, rotation, large, sweep, x, y)
+						}
+					}
+				}
+			}
+		case 'Z', 'z':
+			p.close()
+			// A new subpath starts where the closed one did
+			p.z.MoveTo(p.m.apply(p.startX, p.startY))
+			cmd = 0
+		}
+		if err != nil {
+			return fmt.Errorf("invalid path data: %w", err)
+		}
+	}
+	p.close()
+	return nil
+}
+
+// rect builds a rectangle, with corners rounded by rx and ry if given.
+func (p *svgPath) rect(attrs map[string]string) error {
+	v, err := svgShapeNumbers(attrs, "x", "y", "width", "height", "rx", "ry")
+	if err != nil {
+		return err
+	}
+	x, y, w, h := v[0], v[1], v[2], v[3]
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+
+	// A missing radius takes the other's value
+	_, hasRX := attrs["rx"]
+	_, hasRY := attrs["ry"]
+	rx, ry := v[4], v[5]
+	if !hasRX {
+		rx = ry
+	}
+	if !hasRY {
+		ry = rx
+	}
+	rx, ry = math.Min(rx, w/2), math.Min(ry, h/2)
+
+	if rx <= 0 || ry <= 0 {
+		p.moveTo(x, y)
+		p.lineTo(x+w, y)
+		p.lineTo(x+w, y+h)
+		p.lineTo(x, y+h)
+		p.close()
+		return nil
+	}
+
+	// Round each corner with a quarter ellipse
+	kx, ky := rx*svgKappa, ry*svgKappa
+	p.moveTo(x+rx, y)
+	p.lineTo(x+w-rx, y)
+	p.cubeTo(x+w-rx+kx, y, x+w, y+ry-ky, x+w, y+ry)
+	p.lineTo(x+w, y+h-ry)
+	p.cubeTo(x+w, y+h-ry+ky, x+w-rx+kx, y+h, x+w-rx, y+h)
+	p.lineTo(x+rx, y+h)
+	p.cubeTo(x+rx-kx, y+h, x, y+h-ry+ky, x, y+h-ry)
+	p.lineTo(x, y+ry)
+	p.cubeTo(x, y+ry-ky, x+rx-kx, y, x+rx, y)
+	p.close()
+	return nil
+}
+
+// svgKappa is the distance of the control points from the ends of a cubic
+// Bézier approximating a quarter circle of radius 1.
+const svgKappa = 0.5522847498
+
+// ellipse builds a circle (with r) or an ellipse (with rx and ry).
+func (p *svgPath) ellipse(attrs map[string]string, circle bool) error {
+	v, err := svgShapeNumbers(attrs, "cx", "cy", "r", "rx", "ry")
+	if err != nil {
+		return err
+	}
+	cx, cy, rx, ry := v[0], v[1], v[3], v[4]
+	if circle {
+		rx, ry = v[2], v[2]
+	}
+	if rx <= 0 || ry <= 0 {
+		return nil
+	}
+
+	kx, ky := rx*svgKappa, ry*svgKappa
+	p.moveTo(cx+rx, cy)
+	p.cubeTo(cx+rx, cy+ky, cx+kx, cy+ry, cx, cy+ry)
+	p.cubeTo(cx-kx, cy+ry, cx-rx, cy+ky, cx-rx, cy)
+	p.cubeTo(cx-rx, cy-ky, cx-kx, cy-ry, cx, cy-ry)
+	p.cubeTo(cx+kx, cy-ry, cx+rx, cy-ky, cx+rx, cy)
+	p.close()
+	return nil
+}
+
+// polygon builds a closed shape through the points of a polygon or
+// polyline, which is filled as if it were closed.
+func (p *svgPath) polygon(points string) error {
+	nums, err := svgNumbers(points)
+	if err != nil || len(nums)%2 != 0 {
+		return fmt.Errorf("invalid points '%s'", points)
+	}
+	for i := 0; i+1 < len(nums); i += 2 {
+		if i == 0 {
+			p.moveTo(nums[0], nums[1])
+		} else {
+			p.lineTo(nums[i], nums[i+1])
+		}
+	}
+	p.close()
+	return nil
+}
+
+// svgShapeNumbers parses the named attributes as lengths, treating missing
+// ones as 0.
+func svgShapeNumbers(attrs map[string]string, names ...string) ([]float64, error) {
+	v := make([]float64, len(names))
+	for i, name := range names {
+		s, ok := attrs[name]
+		if !ok {
+			continue
+		}
+		var valid bool
+		if v[i], valid = svgLength(s); !valid {
+			return nil, fmt.Errorf("invalid %s '%s'", name, s)
+		}
+	}
+	return v, nil
+}
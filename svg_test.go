@@ -0,0 +1,164 @@
+package animoji
+
+import (
+	"image"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSVGNumbers(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []float64
+	}{
+		{"", nil},
+		{"1 2 3", []float64{1, 2, 3}},
+		{"1,2,,3", []float64{1, 2, 3}},
+		{"  -1.5e2\t+.5 ", []float64{-150, 0.5}},
+		{"1-2", []float64{1, -2}},
+		{"0.5.5", []float64{0.5, 0.5}},
+		{"1e-2-3E1", []float64{0.01, -30}},
+	} {
+		got, err := svgNumbers(tt.in)
+		if err != nil {
+			t.Errorf("svgNumbers(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("svgNumbers(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"1 x", "NaN", "Inf", "1e999", "--1", "."} {
+		if got, err := svgNumbers(in); err == nil {
+			t.Errorf("svgNumbers(%q) = %v, expected an error", in, got)
+		}
+	}
+}
+
+func TestSVGTransform(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want svgMatrix
+	}{
+		{"", svgMatrix{1, 0, 0, 1, 0, 0}},
+		{"translate(3)", svgMatrix{1, 0, 0, 1, 3, 0}},
+		{"translate(3, 4)", svgMatrix{1, 0, 0, 1, 3, 4}},
+		{"scale(2)", svgMatrix{2, 0, 0, 2, 0, 0}},
+		{"scale(2 3)", svgMatrix{2, 0, 0, 3, 0, 0}},
+		{"matrix(1 2 3 4 5 6)", svgMatrix{1, 2, 3, 4, 5, 6}},
+		{"rotate(90)", svgMatrix{0, 1, -1, 0, 0, 0}},
+		{"rotate(180 5 5)", svgMatrix{-1, 0, 0, -1, 10, 10}},
+		{"skewX(45)", svgMatrix{1, 0, 1, 1, 0, 0}},
+		{"translate(10,0) scale(2)", svgMatrix{2, 0, 0, 2, 10, 0}},
+		{"scale(2), translate(10,0)", svgMatrix{2, 0, 0, 2, 20, 0}},
+	} {
+		got, err := svgTransform(tt.in)
+		if err != nil {
+			t.Errorf("svgTransform(%q): %v", tt.in, err)
+			continue
+		}
+		for i := range got {
+			if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+				t.Errorf("svgTransform(%q) = %v, want %v", tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+
+	for _, in := range []string{"translate", "translate(1", "spin(90)", "matrix(1 2 3)", "scale(a)"} {
+		if _, err := svgTransform(in); err == nil {
+			t.Errorf("svgTransform(%q): expected an error", in)
+		}
+	}
+}
+
+// decodeTestSVG rasterizes an SVG document given as a string.
+func decodeTestSVG(doc string) (*image.RGBA, error) {
+	return decodeSVG(strings.NewReader(doc), 0, 0)
+}
+
+func TestSVGPathData(t *testing.T) {
+	for _, tt := range []struct {
+		d       string
+		in, out image.Point // Pixels that should be filled and left empty
+	}{
+		{"M2 2 L18 2 L18 18 L2 18 Z", image.Pt(10, 10), image.Pt(1, 1)},
+		{"m2,2 16,0 0,16 -16,0 z", image.Pt(10, 10), image.Pt(19, 19)},
+		{"M2 2 H18 V18 H2 Z", image.Pt(17, 17), image.Pt(19, 10)},
+		{"M2 2 h16 v16 h-16 z", image.Pt(3, 3), image.Pt(10, 19)},
+		{"M0 20 Q10 -20 20 20 Z", image.Pt(10, 10), image.Pt(1, 1)},
+		{"M0 20 C0 0 20 0 20 20 Z", image.Pt(10, 10), image.Pt(1, 1)},
+		{"M0 20 C0 10 5 0 10 0 S20 10 20 20 Z", image.Pt(10, 5), image.Pt(1, 1)},
+		{"M0 10 Q5 0 10 10 T20 10 L20 20 L0 20 Z", image.Pt(15, 18), image.Pt(15, 12)},
+		{"M0 10 A10 10 0 0 1 20 10 Z", image.Pt(10, 5), image.Pt(10, 15)},
+		{"M0 10 a10 10 0 0 0 20 0 z", image.Pt(10, 15), image.Pt(10, 5)},
+		{"M0 0 L10 0 L10 10 Z M10 10 L20 10 L20 20 Z", image.Pt(18, 12), image.Pt(2, 18)},
+	} {
+		img, err := decodeTestSVG(`<svg xmlns="http://www.w3.org/2000/svg" width="20" height="20"><path d="` + tt.d + `"/></svg>`)
+		if err != nil {
+			t.Errorf("path %q: %v", tt.d, err)
+			continue
+		}
+		if a := img.RGBAAt(tt.in.X, tt.in.Y).A; a != 255 {
+			t.Errorf("path %q: pixel %v has alpha %d, want 255", tt.d, tt.in, a)
+		}
+		if a := img.RGBAAt(tt.out.X, tt.out.Y).A; a != 0 {
+			t.Errorf("path %q: pixel %v has alpha %d, want 0", tt.d, tt.out, a)
+		}
+	}
+}
+
+func TestSVGMalformed(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		doc  string
+	}{
+		{"not xml", `<svg width="10"`},
+		{"not svg", `<html width="10" height="10"></html>`},
+		{"empty", ``},
+		{"no size", `<svg></svg>`},
+		{"zero size", `<svg width="0" height="0"></svg>`},
+		{"nan size", `<svg width="NaN" height="NaN"></svg>`},
+		{"infinite size", `<svg width="Inf" height="10"></svg>`},
+		{"huge size", `<svg width="1e12" height="1e12"></svg>`},
+		{"too wide", `<svg width="100000" height="1"></svg>`},
+		{"bad viewBox", `<svg viewBox="0 0 10"></svg>`},
+		{"negative viewBox", `<svg viewBox="0 0 -10 10"></svg>`},
+		{"path without moveto", `<svg width="10" height="10"><path d="10 10"/></svg>`},
+		{"path with a missing number", `<svg width="10" height="10"><path d="M1 2 L3"/></svg>`},
+		{"path with a bad arc flag", `<svg width="10" height="10"><path d="M1 1 A5 5 0 2 1 5 5"/></svg>`},
+		{"path with a bad command", `<svg width="10" height="10"><path d="M1 1 X5 5"/></svg>`},
+		{"bad transform", `<svg width="10" height="10"><g transform="spin(3)"/></svg>`},
+		{"gradient fill", `<svg width="10" height="10"><rect width="5" height="5" fill="url(#g)"/></svg>`},
+		{"bad rect", `<svg width="10" height="10"><rect width="x" height="5"/></svg>`},
+	} {
+		if _, err := decodeTestSVG(tt.doc); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestSVGMaxPixels(t *testing.T) {
+	doc := `<svg width="100" height="50"></svg>`
+	if _, err := decodeSVG(strings.NewReader(doc), 0, 5000); err != nil {
+		t.Errorf("100x50 within 5000 pixels: %v", err)
+	}
+	if _, err := decodeSVG(strings.NewReader(doc), 0, 4999); err == nil {
+		t.Errorf("100x50 over 4999 pixels: expected an error")
+	}
+
+	// The limit applies to the size it is rasterized at
+	img, err := decodeSVG(strings.NewReader(doc), 20, 5000)
+	if err != nil {
+		t.Fatalf("rasterizing at width 20: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(20, 10) {
+		t.Errorf("rasterized at %v, want 20x10", size)
+	}
+	if _, err := decodeSVG(strings.NewReader(doc), 1000, 5000); err == nil {
+		t.Errorf("1000x500 over 5000 pixels: expected an error")
+	}
+}